@@ -3,6 +3,7 @@ package DFA
 import (
 	"bytes"
 	"fmt"
+	"sort"
 )
 
 // State store the string as a state id
@@ -29,6 +30,7 @@ type DFA struct {
 	input  *Letter                            // Inputs to the DFA
 	stop   chan struct{}                      // Stops the DFA
 	logger func(State)                        // looger for transitions
+	labels map[State]string                   // labels of states in diagrams
 }
 
 type domainelement struct {
@@ -52,9 +54,11 @@ func New() *DFA {
 		q:      make(map[State]bool),
 		e:      make(map[Letter]bool),
 		d:      make(map[domainelement]*codomainelement),
+		f:      make(map[State]bool),
 		done:   make(chan laststate, 1),
 		stop:   make(chan struct{}),
 		logger: func(State) {},
+		labels: make(map[State]string),
 	}
 }
 
@@ -107,6 +111,11 @@ func (dfa *DFA) SetTerminalStates(f ...State) {
 	}
 }
 
+// SetStateLabel sets the label shown under state s in the diagram
+func (dfa *DFA) SetStateLabel(s State, label string) {
+	dfa.labels[s] = label
+}
+
 // SetTransitionLogger set a logger for dfa
 func (dfa *DFA) SetTransitionLogger(logger func(State)) {
 	dfa.logger = logger
@@ -155,7 +164,7 @@ func (dfa *DFA) Run(init interface{}) (State, bool) {
 	go func() {
 		defer close(dfa.done)
 		// starts at q0
-		s := m.q0
+		s := dfa.q0
 		if dfa.f[s] {
 			dfa.done <- laststate{s, true}
 			return
@@ -200,7 +209,7 @@ func (dfa *DFA) Run(init interface{}) (State, bool) {
 					case func():
 						dfa.logger(s)
 						exec()
-					case func():
+					case func() Letter:
 						dfa.logger(s)
 						l := exec()
 						dfa.input = &l
@@ -246,23 +255,57 @@ func (dfa *DFA) Stop() {
 // GraphViz representation string which can be copy-n-pasted into
 // any online tool like http://graphs.grevian.org/graph to get
 // a diagram of the DFA.
+// An arrow points to the start state, the terminal states are double circles,
+// and the states and transitions are in order of their names
 func (m *DFA) GraphViz() string {
 	var buf bytes.Buffer
-	buf.WriteString("digraph {\n")
-	for do, cdo := range m.d {
-		if do.s == m.q0 {
-			buf.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\"[label=\"%s\"];\n", do.s, cdo.s, do.l))
-		} else if m.f[cdo.s] {
-			buf.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\"[label=\"%s\"];\n", do.s, cdo.s, do.l))
-		} else {
-			buf.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\"[label=\"%s\"];\n", do.s, cdo.s, do.l))
+	buf.WriteString("digraph {\n    rankdir=LR;\n    node [shape=circle];\n")
+	if m.q0 != State("") {
+		buf.WriteString(fmt.Sprintf("    start [shape=point];\n    start -> %q;\n", m.q0))
+	}
+	states := make([]State, 0, len(m.q))
+	for s := range m.q {
+		states = append(states, s)
+	}
+	for s := range m.f {
+		if !m.q[s] {
+			states = append(states, s)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return nameLess(string(states[i]), string(states[j])) })
+	for _, s := range states {
+		label := string(s)
+		if l, ok := m.labels[s]; ok {
+			label += "\n" + l
+		}
+		if m.f[s] {
+			buf.WriteString(fmt.Sprintf("    %q [shape=doublecircle, label=%q];\n", s, label))
+		} else if label != string(s) {
+			buf.WriteString(fmt.Sprintf("    %q [label=%q];\n", s, label))
 		}
 	}
+	trans := make([]domainelement, 0, len(m.d))
+	for do := range m.d {
+		trans = append(trans, do)
+	}
+	sort.Slice(trans, func(i, j int) bool {
+		a, b := trans[i], trans[j]
+		if a.s != b.s {
+			return nameLess(string(a.s), string(b.s))
+		}
+		if m.d[a].s != m.d[b].s {
+			return nameLess(string(m.d[a].s), string(m.d[b].s))
+		}
+		return a.l < b.l
+	})
+	for _, do := range trans {
+		buf.WriteString(fmt.Sprintf("    %q -> %q [label=%q];\n", do.s, m.d[do].s, do.l))
+	}
 	buf.WriteString("}")
 	return buf.String()
 }
 
-func (m *DFA) result() (State, bool) {
-	t := <-m.done
-	return t.s, t.accepted
+// nameLess orders the shorter names first, so s2 is before s10
+func nameLess(a, b string) bool {
+	return len(a) < len(b) || len(a) == len(b) && a < b
 }
@@ -0,0 +1,153 @@
+package DFA
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// DFA returns the DFA.DFA of the table whose GraphViz is the state-transition diagram,
+// the states are named s0, s1 and so on, a letter is the byte ranges of the edge between two states,
+// and the terminal states are the accepting ones labelled by label of their tags.
+// Its transitions read no more letters, so it's only meant to be drawn
+func (t *Table) DFA(label func(tag int) string) *DFA {
+	m := New()
+	name := func(s int) State {
+		return State("s" + strconv.Itoa(s))
+	}
+	m.SetStartState(name(0))
+	for s, tag := range t.Final {
+		if tag >= 0 {
+			m.SetTerminalStates(name(s))
+			m.SetStateLabel(name(s), label(tag))
+		}
+	}
+	for s := range t.Trans {
+		order, ranges := t.Edges(s)
+		for _, n := range order {
+			// SetTransition takes func() into terminal states and func() Letter into the others
+			var exec interface{} = func() Letter { return "" }
+			if t.Final[n] >= 0 {
+				exec = func() {}
+			}
+			m.SetTransition(name(s), Letter(rangesString(ranges[n])), name(n), exec)
+		}
+	}
+	return m
+}
+
+// WriteTable writes the transition table as aligned text, a column is a class of bytes
+// which go to the same states, a cell is the next state or - if there isn't,
+// and the last column is the label of the tag of accepting states
+func (t *Table) WriteTable(w io.Writer, label func(tag int) string) error {
+	classes := t.classes()
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprint(tw, "state")
+	for _, class := range classes {
+		fmt.Fprintf(tw, "\t%s", rangesString(class))
+	}
+	fmt.Fprint(tw, "\taccept\n")
+	for s := range t.Trans {
+		fmt.Fprintf(tw, "s%d", s)
+		for _, class := range classes {
+			if n := t.Trans[s][class[0].Lo]; n >= 0 {
+				fmt.Fprintf(tw, "\ts%d", n)
+			} else {
+				fmt.Fprint(tw, "\t-")
+			}
+		}
+		if tag := t.Final[s]; tag >= 0 {
+			fmt.Fprintf(tw, "\t%s\n", label(tag))
+		} else {
+			fmt.Fprint(tw, "\t\n")
+		}
+	}
+	return tw.Flush()
+}
+
+// ByteRange is the bytes from Lo to Hi
+type ByteRange struct {
+	Lo, Hi int
+}
+
+// Edges groups the bytes of the transitions from state s by their next states,
+// it returns the next states in order of their first bytes and the ranges of each one
+func (t *Table) Edges(s int) ([]int, map[int][]ByteRange) {
+	ranges := make(map[int][]ByteRange)
+	var order []int
+	for b, n := range t.Trans[s] {
+		if n < 0 {
+			continue
+		}
+		rs := ranges[n]
+		if len(rs) == 0 {
+			order = append(order, n)
+		}
+		ranges[n] = appendByte(rs, b)
+	}
+	return order, ranges
+}
+
+// classes groups the bytes which go to the same states from all states,
+// the bytes which go nowhere are left out
+func (t *Table) classes() [][]ByteRange {
+	index := make(map[string]int)
+	var classes [][]ByteRange
+	for b := 0; b < 256; b++ {
+		var key strings.Builder
+		used := false
+		for s := range t.Trans {
+			n := t.Trans[s][b]
+			used = used || n >= 0
+			key.WriteString(strconv.Itoa(n))
+			key.WriteByte(',')
+		}
+		if !used {
+			continue
+		}
+		i, ok := index[key.String()]
+		if !ok {
+			i = len(classes)
+			index[key.String()] = i
+			classes = append(classes, nil)
+		}
+		classes[i] = appendByte(classes[i], b)
+	}
+	return classes
+}
+
+// appendByte appends b to the ascending ranges rs
+func appendByte(rs []ByteRange, b int) []ByteRange {
+	if len(rs) > 0 && rs[len(rs)-1].Hi == b-1 {
+		rs[len(rs)-1].Hi = b
+		return rs
+	}
+	return append(rs, ByteRange{b, b})
+}
+
+// rangesString returns ranges like a-z,0-9,_
+func rangesString(rs []ByteRange) string {
+	strs := make([]string, len(rs))
+	for i, r := range rs {
+		strs[i] = byteString(r.Lo)
+		if r.Hi > r.Lo {
+			strs[i] += "-" + byteString(r.Hi)
+		}
+	}
+	return strings.Join(strs, ",")
+}
+
+// byteString returns a printable form of byte b
+func byteString(b int) string {
+	switch {
+	case b == ' ':
+		return "SP"
+	case b > ' ' && b < 0x7f:
+		return string(rune(b))
+	case b < ' ':
+		return strings.Trim(strconv.QuoteRune(rune(b)), "'")
+	}
+	return fmt.Sprintf("\\x%02x", b)
+}
@@ -0,0 +1,140 @@
+package DFA
+
+import (
+	"strconv"
+
+	"github.com/yjhmelody/compiler-lab/NFA"
+)
+
+// Table is a transition table built from an NFA by subset construction,
+// its start state is 0
+type Table struct {
+	// Trans[s][b] is the next state of s on byte b, it is -1 if there isn't
+	Trans [][256]int
+	// Final[s] is the tag of the accepting state s, it is -1 if s isn't accepting
+	Final []int
+}
+
+// Subset builds the Table of nfa by subset construction,
+// tags maps the accept states of nfa to their tags,
+// a DFA state containing several of them takes the least tag
+func Subset(nfa *NFA.NFA, tags map[NFA.State]int) *Table {
+	t := &Table{}
+	index := make(map[string]int)
+	var sets [][]NFA.State
+
+	add := func(set []NFA.State) int {
+		key := setKey(set)
+		if i, ok := index[key]; ok {
+			return i
+		}
+		i := len(sets)
+		index[key] = i
+		sets = append(sets, set)
+		final := -1
+		for _, s := range set {
+			if tag, ok := tags[s]; ok && (final < 0 || tag < final) {
+				final = tag
+			}
+		}
+		t.Final = append(t.Final, final)
+		t.Trans = append(t.Trans, [256]int{})
+		return i
+	}
+
+	add(nfa.Closure([]NFA.State{nfa.Start()}))
+	for i := 0; i < len(sets); i++ {
+		for b := range t.Trans[i] {
+			t.Trans[i][b] = -1
+		}
+		for _, s := range sets[i] {
+			for _, e := range nfa.Edges(s) {
+				if t.Trans[i][e] >= 0 {
+					continue
+				}
+				// add may grow t.Trans, so don't index it in the same statement
+				n := add(nfa.Closure(nfa.Move(sets[i], e)))
+				t.Trans[i][e] = n
+			}
+		}
+	}
+	return t
+}
+
+// setKey returns the key of a sorted NFA state set
+func setKey(set []NFA.State) string {
+	key := make([]byte, 0, 4*len(set))
+	for _, s := range set {
+		key = strconv.AppendInt(key, int64(s), 36)
+		key = append(key, ',')
+	}
+	return string(key)
+}
+
+// Minimize returns the equivalent Table with the least states by partition refinement,
+// the states are split by their tags at first, then by the blocks of their next states
+func (t *Table) Minimize() *Table {
+	block := make([]int, t.Len())
+	count := 0
+	for {
+		// the signature of a state is its block and the blocks of its next states
+		index := make(map[string]int)
+		next := make([]int, t.Len())
+		for s := range block {
+			sig := make([]byte, 0, 2*257)
+			if count == 0 {
+				sig = strconv.AppendInt(sig, int64(t.Final[s]), 36)
+			} else {
+				sig = strconv.AppendInt(sig, int64(block[s]), 36)
+			}
+			for _, n := range t.Trans[s] {
+				sig = append(sig, ',')
+				if n >= 0 && count > 0 {
+					sig = strconv.AppendInt(sig, int64(block[n]), 36)
+				}
+			}
+			key := string(sig)
+			if _, ok := index[key]; !ok {
+				index[key] = len(index)
+			}
+			next[s] = index[key]
+		}
+		done := len(index) == count
+		block, count = next, len(index)
+		if done {
+			break
+		}
+	}
+
+	// number the blocks so that the start state is still 0
+	number := make([]int, count)
+	for i := range number {
+		number[i] = -1
+	}
+	order := []int{0}
+	number[block[0]] = 0
+	m := &Table{}
+	for i := 0; i < len(order); i++ {
+		s := order[i]
+		m.Final = append(m.Final, t.Final[s])
+		var trans [256]int
+		for b, n := range t.Trans[s] {
+			if n < 0 {
+				trans[b] = -1
+				continue
+			}
+			if number[block[n]] < 0 {
+				number[block[n]] = len(order)
+				order = append(order, n)
+			}
+			trans[b] = number[block[n]]
+		}
+		m.Trans = append(m.Trans, trans)
+	}
+	return m
+}
+
+// Len returns the count of states
+func (t *Table) Len() int {
+	return len(t.Final)
+}
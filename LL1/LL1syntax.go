@@ -25,7 +25,7 @@ type AnalysisTable map[lexer.Token]Items
 
 // defined for syntax
 const (
-	// 29
+	// the symbols of the grammar follow the tokens of the lexer
 	EPISILON lexer.Token = lexer.EPISILON + iota
 	E
 	E2
@@ -72,8 +72,9 @@ var analysisTable = AnalysisTable{
 	},
 }
 
-// Analysis uses the scanner to recognize LL(1) grammar
-func Analysis(s *lexer.Scanner) bool {
+// Analysis reads the tokens of s to recognize LL(1) grammar, the tokens are named by spec,
+// a nil spec is the begin/if/while language
+func Analysis(s lexer.TokenSource, spec *lexer.LexerSpec) bool {
 	flag := true
 	stack := stack.NewStack()
 	stack.Push(lexer.SHARP)
@@ -83,26 +84,34 @@ func Analysis(s *lexer.Scanner) bool {
 	if !ok {
 		fmt.Println("stack error")
 	}
-	_, curTok := s.Next()
+	if spec == nil {
+		spec = lexer.DefaultSpec()
+	}
+	cur := s.Scan()
 	// when stack is not empty
 	for stack.Peak() != lexer.SHARP {
-		if X == curTok {
-			fmt.Println("matched:", X)
-			_, curTok = s.Next()
+		if cur.Tok == lexer.ILLEGAL {
+			// the scanner has reported it, just skip the bad text
+			fmt.Println("illegal token:", spec.LexemeString(cur))
+			cur = s.Scan()
+			flag = false
+		} else if X == cur.Tok {
+			fmt.Println("matched:", spec.TokenString(X), "at", cur.Start)
+			cur = s.Scan()
 			stack.Pop()
 		} else if X < lexer.EPISILON {
 			// when X is a terminal
-			fmt.Println("terminal error:", X, curTok)
+			fmt.Println("terminal error:", spec.TokenString(X), spec.LexemeString(cur))
 			flag = false
-		} else if _, ok := analysisTable[X][curTok]; !ok {
-			fmt.Println("ignore the token:", X, curTok)
-			_, curTok = s.Next()
+		} else if _, ok := analysisTable[X][cur.Tok]; !ok {
+			fmt.Println("ignore the token:", X, spec.LexemeString(cur))
+			cur = s.Scan()
 			flag = false
-		} else if v := analysisTable[X][curTok]; v == nil {
-			fmt.Println("synch error:", X, curTok)
+		} else if v := analysisTable[X][cur.Tok]; v == nil {
+			fmt.Println("synch error:", X, spec.LexemeString(cur))
 			stack.Pop()
 			flag = false
-		} else if v, ok := analysisTable[X][curTok]; ok {
+		} else if v, ok := analysisTable[X][cur.Tok]; ok {
 			fmt.Println("production:", X, "->", v)
 			stack.Pop()
 			// push the production to stack
@@ -1,63 +1,598 @@
 package NFA
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
 // Edge has direction
 type Edge byte
 
 // State has not only one edge
 type State int
 
-// Transport
+// Transport is the key of a transition from state on edge
 type Transport struct {
 	state State
 	edge  Edge
 }
 
-// NFA
+// NFA is built by Thompson construction,
+// it has one start state and one accept state
 type NFA struct {
-	// states map[State]bool
-	// edges  map[Edge]bool
-	// transports map[Transport]State
-	state State
-	edge  Edge
+	start, accept State
+	// the count of states, they are numbered from 0
+	states     int
+	transports map[Transport][]State
+	// edges of each state's transports
+	edges map[State][]Edge
 	// epsilon transport
-	next []*NFA
-}
-
-var stateCount State
-var edgeCount Edge
-var 
-
-func parse(str string) *NFA {
-	nfa := &NFA{}
-	for i := 0; i < len(str); i++ {
-		switch str[i] {
-		case '(':
-			j := i + 1
-			for j < len(str) {
-				if str[j] == ')' {
-					break
-				}
-				j++
+	epsilon map[State][]State
+}
+
+// New returns an NFA with no states
+func New() *NFA {
+	return &NFA{
+		transports: make(map[Transport][]State),
+		edges:      make(map[State][]Edge),
+		epsilon:    make(map[State][]State),
+	}
+}
+
+// Start returns the start state
+func (nfa *NFA) Start() State {
+	return nfa.start
+}
+
+// Accept returns the accept state
+func (nfa *NFA) Accept() State {
+	return nfa.accept
+}
+
+// Len returns the count of states
+func (nfa *NFA) Len() int {
+	return nfa.states
+}
+
+// NewState adds a state to the NFA
+func (nfa *NFA) NewState() State {
+	nfa.states++
+	return State(nfa.states - 1)
+}
+
+// AddTransport adds a transition from state to next on edge
+func (nfa *NFA) AddTransport(state State, edge Edge, next State) {
+	t := Transport{state, edge}
+	if _, ok := nfa.transports[t]; !ok {
+		nfa.edges[state] = append(nfa.edges[state], edge)
+	}
+	nfa.transports[t] = append(nfa.transports[t], next)
+}
+
+// Edges returns the edges of the transports from state
+func (nfa *NFA) Edges(state State) []Edge {
+	return nfa.edges[state]
+}
+
+// AddEpsilon adds an epsilon transition from state to next
+func (nfa *NFA) AddEpsilon(state, next State) {
+	nfa.epsilon[state] = append(nfa.epsilon[state], next)
+}
+
+// Closure returns the sorted epsilon closure of states
+func (nfa *NFA) Closure(states []State) []State {
+	seen := make(map[State]bool)
+	stack := append([]State(nil), states...)
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		stack = append(stack, nfa.epsilon[s]...)
+	}
+	closure := make([]State, 0, len(seen))
+	for s := range seen {
+		closure = append(closure, s)
+	}
+	sort.Slice(closure, func(i, j int) bool { return closure[i] < closure[j] })
+	return closure
+}
+
+// Move returns the states reached from states on edge
+func (nfa *NFA) Move(states []State, edge Edge) []State {
+	var next []State
+	for _, s := range states {
+		next = append(next, nfa.transports[Transport{s, edge}]...)
+	}
+	return next
+}
+
+// Match returns true if the NFA accepts str
+func (nfa *NFA) Match(str string) bool {
+	states := nfa.Closure([]State{nfa.start})
+	for i := 0; i < len(str) && len(states) > 0; i++ {
+		states = nfa.Closure(nfa.Move(states, Edge(str[i])))
+	}
+	for _, s := range states {
+		if s == nfa.accept {
+			return true
+		}
+	}
+	return false
+}
+
+// Union joins nfas by a new start state with epsilon transitions to their start states,
+// it returns the new NFA and the accept state of each one in it
+func Union(nfas ...*NFA) (*NFA, []State) {
+	u := New()
+	u.start = u.NewState()
+	accepts := make([]State, len(nfas))
+	for i, nfa := range nfas {
+		base := State(u.states)
+		u.states += nfa.states
+		for t, next := range nfa.transports {
+			for _, s := range next {
+				u.AddTransport(t.state+base, t.edge, s+base)
+			}
+		}
+		for from, next := range nfa.epsilon {
+			for _, s := range next {
+				u.AddEpsilon(from+base, s+base)
 			}
-			subStr := str[i+1 : j]
-			subnfa := parse(subStr)
+		}
+		u.AddEpsilon(u.start, nfa.start+base)
+		accepts[i] = nfa.accept + base
+	}
+	// the union has no single accept state
+	u.accept = -1
+	return u, accepts
+}
 
-		// case ')':
+// SyntaxError is a malformed regex, Pos is the byte offset of the error in it
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
 
-		case '*':
+// Error implements the error interface
+func (e *SyntaxError) Error() string {
+	return strconv.Itoa(e.Pos) + ": " + e.Msg
+}
 
-		case '|':
+// Compile parses the regex str and builds its NFA, the syntax is
+//
+//	concatenation, alternation |, grouping ( )
+//	repetition * + ? and {m} {m,} {m,n} of at most 1000, which expand to at most 100000 states
+//	. for any byte but \n, classes of bytes [a-z0-9_] and negated ones [^...]
+//	escapes \d \w \s and their negations \D \W \S, \n \t \r \f \v, and \c for any other char c
+//
+// All of them are desugared into Thompson constructions on bytes. A malformed regex is a *SyntaxError
+func Compile(str string) (*NFA, error) {
+	p := &parser{str: str, nfa: New()}
+	f, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(str) {
+		// parseAlt stops only at an unbalanced )
+		return nil, p.error(p.pos, "unexpected )")
+	}
+	p.nfa.start, p.nfa.accept = f.start, f.accept
+	return p.nfa, nil
+}
 
+// maxRepeat is the largest count of {m,n}
+const maxRepeat = 1000
+
+// maxStates is the most states of the NFA that {m,n} may expand to,
+// nested counts like (a{1000}){1000} multiply the copies
+const maxStates = 100000
+
+// parser is a recursive descent parser of regex,
+// each parse method returns the fragment of the NFA it builds
+type parser struct {
+	str string
+	pos int
+	nfa *NFA
+}
+
+// frag is a fragment of the NFA, its states are numbered from lo to hi-1
+// and no transitions leave them but those added after it is built
+type frag struct {
+	start, accept State
+	lo, hi        State
+}
+
+// error returns a syntax error at pos
+func (p *parser) error(pos int, msg string) error {
+	return &SyntaxError{Pos: pos, Msg: msg}
+}
+
+// peek returns true if the next char is ch
+func (p *parser) peek(ch byte) bool {
+	return p.pos < len(p.str) && p.str[p.pos] == ch
+}
+
+// frag returns the fragment from start to accept of the states from lo
+func (p *parser) frag(start, accept, lo State) frag {
+	return frag{start, accept, lo, State(p.nfa.states)}
+}
+
+// parseAlt parses concat ('|' concat)*
+func (p *parser) parseAlt() (frag, error) {
+	lo := State(p.nfa.states)
+	f, err := p.parseConcat()
+	if err != nil {
+		return f, err
+	}
+	for p.peek('|') {
+		p.pos++
+		g, err := p.parseConcat()
+		if err != nil {
+			return g, err
+		}
+		start, accept := p.nfa.NewState(), p.nfa.NewState()
+		p.nfa.AddEpsilon(start, f.start)
+		p.nfa.AddEpsilon(start, g.start)
+		p.nfa.AddEpsilon(f.accept, accept)
+		p.nfa.AddEpsilon(g.accept, accept)
+		f = p.frag(start, accept, lo)
+	}
+	return f, nil
+}
+
+// parseConcat parses repeat*, an empty concatenation matches the empty string
+func (p *parser) parseConcat() (frag, error) {
+	lo := p.nfa.NewState()
+	accept := lo
+	for p.pos < len(p.str) && p.str[p.pos] != '|' && p.str[p.pos] != ')' {
+		f, err := p.parseRepeat()
+		if err != nil {
+			return f, err
+		}
+		p.nfa.AddEpsilon(accept, f.start)
+		accept = f.accept
+	}
+	return p.frag(lo, accept, lo), nil
+}
+
+// parseRepeat parses atom ('*' | '+' | '?' | '{' m [',' [n]] '}')*
+func (p *parser) parseRepeat() (frag, error) {
+	lo := State(p.nfa.states)
+	f, err := p.parseAtom()
+	if err != nil {
+		return f, err
+	}
+	for p.pos < len(p.str) {
+		switch p.str[p.pos] {
+		case '*':
+			p.pos++
+			f = p.star(f, lo)
+		case '+':
+			// f f*, the loop back to f.start is the star of the same fragment
+			p.pos++
+			start, accept := p.nfa.NewState(), p.nfa.NewState()
+			p.nfa.AddEpsilon(start, f.start)
+			p.nfa.AddEpsilon(f.accept, f.start)
+			p.nfa.AddEpsilon(f.accept, accept)
+			f = p.frag(start, accept, lo)
+		case '?':
+			p.pos++
+			f = p.quest(f, lo)
+		case '{':
+			open := p.pos
+			min, max, err := p.parseCount()
+			if err != nil {
+				return f, err
+			}
+			var ok bool
+			if f, ok = p.repeat(f, min, max, lo); !ok {
+				return f, p.error(open, "repetition "+p.str[open:p.pos]+" makes too many states")
+			}
 		default:
-			nfa.edge = Edge(str[i])
-			nfa.state = stateCount
-			nfa.next
-			stateCount++
+			return f, nil
 		}
 	}
-	return nfa
+	return f, nil
+}
+
+// star returns f*
+func (p *parser) star(f frag, lo State) frag {
+	start, accept := p.nfa.NewState(), p.nfa.NewState()
+	p.nfa.AddEpsilon(start, f.start)
+	p.nfa.AddEpsilon(start, accept)
+	p.nfa.AddEpsilon(f.accept, f.start)
+	p.nfa.AddEpsilon(f.accept, accept)
+	return p.frag(start, accept, lo)
 }
 
-func parseAtom(str string) {
+// quest returns f?
+func (p *parser) quest(f frag, lo State) frag {
+	start, accept := p.nfa.NewState(), p.nfa.NewState()
+	p.nfa.AddEpsilon(start, f.start)
+	p.nfa.AddEpsilon(start, accept)
+	p.nfa.AddEpsilon(f.accept, accept)
+	return p.frag(start, accept, lo)
+}
+
+// parseCount parses {m}, {m,} or {m,n}, max is -1 if there's no upper bound
+func (p *parser) parseCount() (min, max int, err error) {
+	open := p.pos
+	p.pos++
+	min, ok := p.parseInt()
+	if !ok {
+		return 0, 0, p.error(open, "malformed repetition count")
+	}
+	max = min
+	if p.peek(',') {
+		p.pos++
+		if max, ok = p.parseInt(); !ok {
+			max = -1
+		}
+	}
+	if !p.peek('}') {
+		return 0, 0, p.error(open, "malformed repetition count")
+	}
+	p.pos++
+	if min > maxRepeat || max > maxRepeat || (max >= 0 && max < min) {
+		return 0, 0, p.error(open, "invalid repetition count "+p.str[open:p.pos])
+	}
+	return min, max, nil
+}
+
+// parseInt parses a decimal number
+func (p *parser) parseInt() (int, bool) {
+	start := p.pos
+	for p.pos < len(p.str) && p.str[p.pos] >= '0' && p.str[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.str[start:p.pos])
+	return n, err == nil
+}
+
+// repeat returns f{min,max} as min copies of f followed by max-min optional ones,
+// or by the star of f if max is -1, it fails if the copies make more than maxStates states
+func (p *parser) repeat(f frag, min, max int, lo State) (frag, bool) {
+	n := max
+	if max < 0 {
+		n = min + 1
+	}
+	if n == 0 {
+		// f is left unreachable
+		s := p.nfa.NewState()
+		return p.frag(s, s, lo), true
+	}
+	// each copy is linked by the states of ? or *
+	if p.nfa.states+(n-1)*int(f.hi-f.lo)+2*n > maxStates {
+		return f, false
+	}
+	// copy f before linking it, so the copies have no transitions out
+	copies := []frag{f}
+	for len(copies) < n {
+		copies = append(copies, p.copy(f))
+	}
+	for i := min; i < len(copies); i++ {
+		if max < 0 {
+			copies[i] = p.star(copies[i], copies[i].lo)
+		} else {
+			copies[i] = p.quest(copies[i], copies[i].lo)
+		}
+	}
+	for i := 1; i < len(copies); i++ {
+		p.nfa.AddEpsilon(copies[i-1].accept, copies[i].start)
+	}
+	return p.frag(copies[0].start, copies[len(copies)-1].accept, lo), true
+}
+
+// copy returns a copy of the fragment f with new states
+func (p *parser) copy(f frag) frag {
+	lo := State(p.nfa.states)
+	delta := lo - f.lo
+	p.nfa.states += int(f.hi - f.lo)
+	for s := f.lo; s < f.hi; s++ {
+		for _, e := range p.nfa.edges[s] {
+			for _, next := range p.nfa.transports[Transport{s, e}] {
+				p.nfa.AddTransport(s+delta, e, next+delta)
+			}
+		}
+		for _, next := range p.nfa.epsilon[s] {
+			p.nfa.AddEpsilon(s+delta, next+delta)
+		}
+	}
+	return p.frag(f.start+delta, f.accept+delta, lo)
+}
+
+// parseAtom parses '(' alt ')', a class, '.', an escape or a char
+func (p *parser) parseAtom() (frag, error) {
+	lo := State(p.nfa.states)
+	switch ch := p.str[p.pos]; ch {
+	case '(':
+		open := p.pos
+		p.pos++
+		f, err := p.parseAlt()
+		if err != nil {
+			return f, err
+		}
+		if p.pos >= len(p.str) {
+			return f, p.error(open, "missing ) for (")
+		}
+		p.pos++
+		return p.frag(f.start, f.accept, lo), nil
+	case '*', '+', '?', '{':
+		return frag{}, p.error(p.pos, "missing argument to "+string(ch))
+	case '[':
+		set, err := p.parseClass()
+		if err != nil {
+			return frag{}, err
+		}
+		return p.set(set, lo), nil
+	case '.':
+		p.pos++
+		var set byteSet
+		set.negate()
+		set.remove('\n')
+		return p.set(set, lo), nil
+	case '\\':
+		set, err := p.parseEscape()
+		if err != nil {
+			return frag{}, err
+		}
+		return p.set(set, lo), nil
+	default:
+		p.pos++
+		var set byteSet
+		set.add(ch, ch)
+		return p.set(set, lo), nil
+	}
+}
+
+// set returns the fragment matching a byte of set
+func (p *parser) set(set byteSet, lo State) frag {
+	start, accept := p.nfa.NewState(), p.nfa.NewState()
+	for b := 0; b < 256; b++ {
+		if set.has(byte(b)) {
+			p.nfa.AddTransport(start, Edge(b), accept)
+		}
+	}
+	return p.frag(start, accept, lo)
+}
+
+// parseClass parses '[' '^'? (item | item '-' item)+ ']',
+// a ] right after [ or [^ and a - at either end are literal
+func (p *parser) parseClass() (byteSet, error) {
+	var set byteSet
+	open := p.pos
+	p.pos++
+	negated := p.peek('^')
+	if negated {
+		p.pos++
+	}
+	first := p.pos
+	for {
+		if p.pos >= len(p.str) {
+			return set, p.error(open, "missing ] for [")
+		}
+		if p.str[p.pos] == ']' && p.pos > first {
+			break
+		}
+		start := p.pos
+		lo, loSet, err := p.parseClassItem()
+		if err != nil {
+			return set, err
+		}
+		if !p.peek('-') || p.pos+1 >= len(p.str) || p.str[p.pos+1] == ']' {
+			if loSet != nil {
+				set.union(*loSet)
+			} else {
+				set.add(lo, lo)
+			}
+			continue
+		}
+		p.pos++
+		hi, hiSet, err := p.parseClassItem()
+		if err != nil {
+			return set, err
+		}
+		if loSet != nil || hiSet != nil || hi < lo {
+			return set, p.error(start, "invalid class range "+p.str[start:p.pos])
+		}
+		set.add(lo, hi)
+	}
+	p.pos++
+	if negated {
+		set.negate()
+	}
+	return set, nil
+}
+
+// parseClassItem parses a char or an escape of a class, the escape of a class like \d is a set
+func (p *parser) parseClassItem() (byte, *byteSet, error) {
+	ch := p.str[p.pos]
+	if ch != '\\' {
+		p.pos++
+		return ch, nil, nil
+	}
+	if p.pos+1 < len(p.str) && strings.IndexByte("dwsDWS", p.str[p.pos+1]) >= 0 {
+		set, err := p.parseEscape()
+		return 0, &set, err
+	}
+	set, err := p.parseEscape()
+	for b := 0; b < 256; b++ {
+		if set.has(byte(b)) {
+			ch = byte(b)
+		}
+	}
+	return ch, nil, err
+}
+
+// parseEscape parses '\' c and returns the bytes it matches
+func (p *parser) parseEscape() (byteSet, error) {
+	var set byteSet
+	p.pos++
+	if p.pos >= len(p.str) {
+		return set, p.error(p.pos-1, "trailing \\")
+	}
+	ch := p.str[p.pos]
+	p.pos++
+	switch ch {
+	case 'd', 'D':
+		set.add('0', '9')
+	case 'w', 'W':
+		set.add('0', '9')
+		set.add('A', 'Z')
+		set.add('a', 'z')
+		set.add('_', '_')
+	case 's', 'S':
+		for _, b := range []byte(" \t\n\r\f\v") {
+			set.add(b, b)
+		}
+	case 'n':
+		set.add('\n', '\n')
+	case 't':
+		set.add('\t', '\t')
+	case 'r':
+		set.add('\r', '\r')
+	case 'f':
+		set.add('\f', '\f')
+	case 'v':
+		set.add('\v', '\v')
+	default:
+		set.add(ch, ch)
+	}
+	if ch == 'D' || ch == 'W' || ch == 'S' {
+		set.negate()
+	}
+	return set, nil
+}
+
+// byteSet is a set of bytes
+type byteSet [4]uint64
+
+func (set *byteSet) add(lo, hi byte) {
+	for b := int(lo); b <= int(hi); b++ {
+		set[b/64] |= 1 << uint(b%64)
+	}
+}
+
+func (set *byteSet) remove(b byte) {
+	set[b/64] &^= 1 << uint(b%64)
+}
+
+func (set *byteSet) union(other byteSet) {
+	for i := range set {
+		set[i] |= other[i]
+	}
+}
+
+func (set *byteSet) negate() {
+	for i := range set {
+		set[i] = ^set[i]
+	}
+}
 
+func (set *byteSet) has(b byte) bool {
+	return set[b/64]&(1<<uint(b%64)) != 0
 }
@@ -0,0 +1,110 @@
+package NFA
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		regex string
+		yes   []string
+		no    []string
+	}{
+		{"", []string{""}, []string{"a"}},
+		{"abc", []string{"abc"}, []string{"", "ab", "abcd"}},
+		{"a|b|", []string{"a", "b", ""}, []string{"ab"}},
+		{"a*", []string{"", "a", "aaaa"}, []string{"b", "ab"}},
+		{"(a|b)*abb", []string{"abb", "aabb", "babababb"}, []string{"ab", "abba"}},
+		{"(ab)**", []string{"", "ab", "abab"}, []string{"aba"}},
+		{"a()b", []string{"ab"}, []string{"a()b"}},
+		{`\(\*\|\\`, []string{`(*|\`}, []string{"("}},
+		{"(ab)+c?", []string{"ab", "ababc"}, []string{"", "c", "abcc"}},
+		{"a.c", []string{"abc", "a.c"}, []string{"ac", "a\nc"}},
+		{"[a-c_]x", []string{"ax", "cx", "_x"}, []string{"dx", "x"}},
+		{"[^a-c\n]", []string{"d", "-"}, []string{"a", "\n", ""}},
+		{"[]a-]*", []string{"", "]a-"}, []string{"b"}},
+		{`\d+\s\w\W`, []string{"12 a!"}, []string{"1 a", "a a!"}},
+		{`[\d\]]\n\t`, []string{"1\n\t", "]\n\t"}, []string{"a\n\t"}},
+		{"a{2}", []string{"aa"}, []string{"a", "aaa"}},
+		{"a{2,}", []string{"aa", "aaaaa"}, []string{"a"}},
+		{"(a|bc){1,2}", []string{"a", "bca"}, []string{"", "abca"}},
+		{"a{0,1}b{0}", []string{"", "a"}, []string{"b"}},
+		{"(a{10}){100}", []string{strings.Repeat("a", 1000)}, []string{strings.Repeat("a", 999)}},
+		{"[a-zA-Z_$][a-zA-Z_$0-9]*", []string{"x", "$a_1"}, []string{"1a", ""}},
+		{"[0-9]|[1-9][0-9]*|$[0-9a-fA-F]+|0[xX][0-9a-fA-F]+", []string{"0", "42", "$fF", "0x1A"}, []string{"0x", "$", "1g"}},
+	}
+	for _, test := range tests {
+		nfa, err := Compile(test.regex)
+		if err != nil {
+			t.Errorf("%q: %v", test.regex, err)
+			continue
+		}
+		for _, str := range test.yes {
+			if !nfa.Match(str) {
+				t.Errorf("%q doesn't match %q", test.regex, str)
+			}
+		}
+		for _, str := range test.no {
+			if nfa.Match(str) {
+				t.Errorf("%q matches %q", test.regex, str)
+			}
+		}
+	}
+}
+
+func TestThompson(t *testing.T) {
+	nfa, err := Compile("(a|b)*c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the accept state has no transitions out and nothing goes into the start state
+	if len(nfa.Edges(nfa.Accept())) != 0 || len(nfa.epsilon[nfa.Accept()]) != 0 {
+		t.Errorf("accept state %d has transitions", nfa.Accept())
+	}
+	for s := State(0); s < State(nfa.Len()); s++ {
+		for _, next := range nfa.epsilon[s] {
+			if next == nfa.Start() {
+				t.Errorf("epsilon transition from %d into start state", s)
+			}
+		}
+		for _, e := range nfa.Edges(s) {
+			for _, next := range nfa.Move([]State{s}, e) {
+				if next == nfa.Start() {
+					t.Errorf("transition from %d on %c into start state", s, e)
+				}
+			}
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		regex string
+		pos   int
+		msg   string
+	}{
+		{"a(b", 1, "missing ) for ("},
+		{"(a(b)", 0, "missing ) for ("},
+		{"ab)c", 2, "unexpected )"},
+		{"a|*", 2, "missing argument to *"},
+		{"(*a)", 1, "missing argument to *"},
+		{`ab\`, 2, `trailing \`},
+		{"+a", 0, "missing argument to +"},
+		{"a[bc", 1, "missing ] for ["},
+		{"[c-a]", 1, "invalid class range c-a"},
+		{"a{2,1}", 1, "invalid repetition count {2,1}"},
+		{"a{1001}", 1, "invalid repetition count {1001}"},
+		{"(a{1000}){1000}", 9, "repetition {1000} makes too many states"},
+		{"a{1000}{1000}", 7, "repetition {1000} makes too many states"},
+		{"a{2", 1, "malformed repetition count"},
+		{"a{,2}", 1, "malformed repetition count"},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.regex)
+		e, ok := err.(*SyntaxError)
+		if !ok || e.Pos != test.pos || e.Msg != test.msg {
+			t.Errorf("%q: got %v, expected %d: %s", test.regex, err, test.pos, test.msg)
+		}
+	}
+}
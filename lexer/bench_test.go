@@ -0,0 +1,234 @@
+package lexer
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// benchProgram generates a large program of identifiers, keywords, numbers and operators
+func benchProgram() string {
+	var b strings.Builder
+	for i := 0; b.Len() < 1<<20; i++ {
+		n := strconv.Itoa(i % 100)
+		b.WriteString("begin count" + n + " := count" + n + " + " + strconv.Itoa(i) + ";\n")
+		b.WriteString("  while total <> 0 do total := total - step" + n + " * 2;\n")
+		b.WriteString("  if total >= 10 then result := (total / 3) end\nend;\n")
+	}
+	return b.String()
+}
+
+// oldRules are the rules of the Initial condition with the readers of numbers,
+// identifiers and operators of the scanner before lexemes were sliced out of the input,
+// which built every lexeme by appending its chars, they are the baseline of the benchmarks
+func oldRules() []Rule {
+	rules := DefaultRules()
+	for i := range rules {
+		switch reflect.ValueOf(rules[i].Read).Pointer() {
+		case reflect.ValueOf((*Scanner).readNum).Pointer():
+			rules[i].Read = oldReadNum
+		case reflect.ValueOf((*Scanner).readID).Pointer():
+			rules[i].Read = oldReadID
+		case reflect.ValueOf((*Scanner).readOp).Pointer():
+			rules[i].Read = oldReadOp
+		}
+	}
+	return rules
+}
+
+// oldReadNum is the old readNum which copied the lexeme out of lit
+func oldReadNum(s *Scanner) error {
+	ch := s.input.Peek()
+	if ch == '$' {
+		s.take()
+		return s.readHex()
+	}
+
+	if ch == '0' {
+		ch = s.take()
+		if ch == 'x' || ch == 'X' {
+			s.take()
+			return s.readHex()
+		}
+		// if ch == '0'但下一个字符为数字则跳过并且报错
+		if IsDigit(ch) {
+			code := ErrLeadingZero
+			for ; IsLetterOrDigit(ch); ch = s.take() {
+				if IsLetter(ch) {
+					code = ErrNumLetter
+				}
+			}
+			return s.collapse(code, string(s.lit), "illegal number "+string(s.lit))
+		}
+	} else {
+		// 一直读完数字
+		for IsDigit(ch) {
+			ch = s.take()
+		}
+	}
+
+	isReal := false
+	// fraction, '.' must be followed by a digit so that 1..9 isn't a real
+	if ch == '.' {
+		ch, _ = s.input.Next()
+		s.input.Back()
+		if IsDigit(ch) {
+			isReal = true
+			for ch = s.take(); IsDigit(ch); {
+				ch = s.take()
+			}
+		} else {
+			ch = '.'
+		}
+	}
+	// exponent
+	if ch == 'e' || ch == 'E' {
+		isReal = true
+		ch = s.take()
+		if ch == '+' || ch == '-' {
+			ch = s.take()
+		}
+		if !IsDigit(ch) {
+			s.skipLetterOrDigit()
+			return s.collapse(ErrExponent, string(s.lit), "malformed exponent "+string(s.lit))
+		}
+		for IsDigit(ch) {
+			ch = s.take()
+		}
+	}
+	// 数字后面紧接着字母则报错并且移动到第一个运算符号或空白符
+	if IsLetterOrDigit(ch) {
+		s.skipLetterOrDigit()
+		return s.collapse(ErrNumLetter, string(s.lit), "illegal number "+string(s.lit))
+	}
+
+	str := string(s.lit)
+	if isReal {
+		val, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return s.collapse(ErrOverflow, str, "real overflow "+str)
+		}
+		s.setLex(str, REALNUM)
+		s.val = val
+		return nil
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return s.collapse(ErrOverflow, str, "integer overflow "+str)
+	}
+	s.setLex(str, INTNUM)
+	s.val = val
+	return nil
+}
+
+// oldReadID is the old readID which concatenated the chars of the lexeme
+func oldReadID(s *Scanner) error {
+	// first unicode letter
+	ch := s.input.Peek()
+	str := string(ch)
+	// unicode letter or digit
+	for {
+		ch, _ = s.input.Next()
+		if IsLetterOrDigit(ch) {
+			str += string(ch)
+		} else {
+			// fmt.Println("ID:"+str, string(ch))
+			break
+		}
+	}
+	// recognize keywords
+	if kw, ok := s.spec.keywords[str]; ok {
+		s.setLex(str, kw)
+	} else {
+		s.setLex(str, ID)
+	}
+	return nil
+}
+
+// oldReadOp is the old readOp which copied the lexeme out of lit
+func oldReadOp(s *Scanner) error {
+	node := s.spec.ops
+	tok := ILLEGAL
+	// the count of chars taken, and the count and bytes of the last operator prefix,
+	// the first char is an unknown operator if no prefix is
+	taken, n, size := 0, 1, 0
+	for !s.input.EOF() {
+		next, ok := node.next[s.input.Peek()]
+		if !ok {
+			break
+		}
+		s.take()
+		if taken++; taken == 1 {
+			size = len(s.lit)
+		}
+		if node = next; node.accept {
+			tok, n, size = node.tok, taken, len(s.lit)
+		}
+	}
+	for ; taken > n; taken-- {
+		s.input.Back()
+	}
+	s.lit = s.lit[:size]
+	str := string(s.lit)
+	if tok == ILLEGAL {
+		return s.collapse(ErrUnknownOp, str, "unknown operator "+str)
+	}
+	s.setLex(str, tok)
+	return nil
+}
+
+// scanCount lexes all tokens of s and returns their count
+func scanCount(s *Scanner) int {
+	for n := 1; ; n++ {
+		if s.Scan(); s.EOF() {
+			return n
+		}
+	}
+}
+
+// benchmark runs scan over the bench program and reports the allocations per token
+func benchmark(b *testing.B, scan func(program string) int) {
+	program := benchProgram()
+	b.SetBytes(int64(len(program)))
+	b.ReportAllocs()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	mallocs := stats.Mallocs
+	tokens := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tokens += scan(program)
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&stats)
+	b.ReportMetric(float64(stats.Mallocs-mallocs)/float64(tokens), "allocs/token")
+}
+
+func BenchmarkScan(b *testing.B) {
+	benchmark(b, func(program string) int {
+		return scanCount(NewScanner(NewInput(program)))
+	})
+}
+
+func BenchmarkScanReader(b *testing.B) {
+	benchmark(b, func(program string) int {
+		return scanCount(NewScanner(NewReaderInput(strings.NewReader(program))))
+	})
+}
+
+func BenchmarkOldScan(b *testing.B) {
+	benchmark(b, func(program string) int {
+		s := NewScanner(NewInput(program))
+		s.DefineCondition(Initial, Condition{Rules: oldRules()})
+		return scanCount(s)
+	})
+}
+
+func BenchmarkLexParallel(b *testing.B) {
+	benchmark(b, func(program string) int {
+		tokens, _ := LexParallel(program, nil, 0, 0)
+		return len(tokens)
+	})
+}
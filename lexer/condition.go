@@ -0,0 +1,136 @@
+package lexer
+
+// Initial is the name of the default start condition,
+// its rules read the tokens of the spec
+const Initial = "INITIAL"
+
+// Rule reads a token of a start condition, Start returns true if the rule applies at current char
+// and Read reads the token. Read takes the chars of the token by Scanner.Take and records it
+// by Scanner.Emit, it may push, pop or switch start conditions like the actions of flex.
+// The error returned by Read is a lexical error, and Read must read at least one char
+type Rule struct {
+	Start func(s *Scanner) bool
+	Read  func(s *Scanner) error
+}
+
+// Condition is a start condition, a named lexer mode with its own rules,
+// the rules are tried in order and the first one which applies reads the token
+type Condition struct {
+	Rules []Rule
+	// KeepSpace doesn't skip the whitespace before tokens so that the rules read it
+	KeepSpace bool
+}
+
+// initial is the Initial condition of scanners which don't redefine it
+var initial = &Condition{Rules: DefaultRules()}
+
+// DefaultRules returns the rules of the Initial condition, they read the end '#', comments,
+// strings, numbers, identifiers and operators, and skip a run of illegal chars
+func DefaultRules() []Rule {
+	return []Rule{
+		{Start: peekIs('#'), Read: (*Scanner).readSharp},
+		{Start: (*Scanner).commentAhead, Read: (*Scanner).readComment},
+		{Start: peekIs('\''), Read: (*Scanner).readString},
+		{Start: func(s *Scanner) bool {
+			ch := s.input.Peek()
+			return IsDigit(ch) || ch == '$'
+		}, Read: (*Scanner).readNum},
+		{Start: func(s *Scanner) bool { return IsLetter(s.input.Peek()) }, Read: (*Scanner).readID},
+		{Start: func(s *Scanner) bool { return s.spec.IsOpStart(s.input.Peek()) }, Read: (*Scanner).readOp},
+		{Start: func(s *Scanner) bool { return true }, Read: (*Scanner).readIllegal},
+	}
+}
+
+// peekIs returns a Rule.Start which is true if current char is ch
+func peekIs(ch rune) func(s *Scanner) bool {
+	return func(s *Scanner) bool {
+		return s.input.Peek() == ch
+	}
+}
+
+// DefineCondition defines the start condition name, a defined one is replaced
+func (s *Scanner) DefineCondition(name string, cond Condition) {
+	if s.conds == nil {
+		s.conds = make(map[string]*Condition)
+	}
+	s.conds[name] = &cond
+	s.enter(s.Condition())
+}
+
+// Condition returns the name of current start condition
+func (s *Scanner) Condition() string {
+	if s.condName == "" {
+		return Initial
+	}
+	return s.condName
+}
+
+// PushCondition saves current start condition and enters the condition name
+func (s *Scanner) PushCondition(name string) {
+	s.condStack = append(s.condStack, s.Condition())
+	s.enter(name)
+}
+
+// PopCondition returns to the start condition saved by the last PushCondition,
+// a pop of the empty stack is a lexical error
+func (s *Scanner) PopCondition() {
+	if len(s.condStack) == 0 {
+		s.error(s.input.Pos(), ErrCondition, "pop of empty start condition stack")
+		return
+	}
+	name := s.condStack[len(s.condStack)-1]
+	s.condStack = s.condStack[:len(s.condStack)-1]
+	s.enter(name)
+}
+
+// SwitchCondition replaces current start condition by the condition name like BEGIN of flex
+func (s *Scanner) SwitchCondition(name string) {
+	s.enter(name)
+}
+
+// enter makes the condition name current, an undefined one is a lexical error
+func (s *Scanner) enter(name string) {
+	cond, ok := s.conds[name]
+	if !ok {
+		if name != Initial {
+			s.error(s.input.Pos(), ErrCondition, "undefined start condition "+name)
+			return
+		}
+		cond = initial
+	}
+	s.condName = name
+	s.cond = cond
+}
+
+// Input returns the input of the scanner, rules look at the chars by it
+func (s *Scanner) Input() *Input {
+	return s.input
+}
+
+// Take appends current char to the text of the token being read and returns the next char
+func (s *Scanner) Take() rune {
+	return s.take()
+}
+
+// Text returns the chars taken for the token being read
+func (s *Scanner) Text() string {
+	return string(s.lit)
+}
+
+// Emit records the chars taken as a token of tok whose value is val
+func (s *Scanner) Emit(tok Token, val interface{}) {
+	s.setLex(string(s.lit), tok)
+	s.val = val
+}
+
+// Fail records the chars taken as an ILLEGAL token and returns the lexical error
+func (s *Scanner) Fail(code ErrorCode, msg string) error {
+	return s.collapse(code, string(s.lit), msg)
+}
+
+// readSharp read the end '#'
+func (s *Scanner) readSharp() error {
+	s.setLex("#", SHARP)
+	s.input.Next()
+	return nil
+}
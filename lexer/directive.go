@@ -0,0 +1,248 @@
+package lexer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Preprocessor scans the tokens of a file and expands its directives, they are comments like
+//
+//	{$include 'file'}  {$define X}  {$undef X}  {$ifdef X} ... {$else} ... {$endif}  {$ifndef X}
+//
+// The included files are scanned on a stack of inputs and added to the file set,
+// so the position of every token names the file it comes from.
+// It is a TokenSource
+type Preprocessor struct {
+	fset    *FileSet
+	spec    *LexerSpec
+	mode    Mode
+	frames  []*frame
+	defined map[string]bool
+	lex     Lexeme
+	errors  ErrorList
+	// ReadFile reads an included file, the name is relative to the including file
+	ReadFile func(name string) ([]byte, error)
+	// ErrorCount is the number of errors encountered
+	ErrorCount int
+}
+
+// frame is a file being scanned with its open conditionals
+type frame struct {
+	file    *File
+	scanner *Scanner
+	conds   []conditional
+}
+
+// conditional is an {$ifdef} whose {$endif} isn't met yet
+type conditional struct {
+	pos Position
+	// outer is true if the enclosing text is active, taken if the {$ifdef} branch is
+	outer, taken, elsed bool
+}
+
+// NewPreprocessor creates a preprocessor of file f in fset, the tokens are those of spec
+func NewPreprocessor(fset *FileSet, f *File, spec *LexerSpec) *Preprocessor {
+	p := &Preprocessor{
+		fset:     fset,
+		spec:     spec,
+		defined:  make(map[string]bool),
+		ReadFile: ioutil.ReadFile,
+	}
+	p.push(f)
+	return p
+}
+
+// SetMode sets the mode which controls the scanners of the files
+func (p *Preprocessor) SetMode(mode Mode) {
+	p.mode = mode
+	for _, fr := range p.frames {
+		fr.scanner.SetMode(mode | ScanComments)
+	}
+}
+
+// Define defines the symbol name for {$ifdef}
+func (p *Preprocessor) Define(name string) {
+	p.defined[strings.ToLower(name)] = true
+}
+
+// Errors returns all lexical and directive errors accumulated so far
+func (p *Preprocessor) Errors() ErrorList {
+	return p.errors
+}
+
+// EOF returns true if token is the '#' of the file
+func (p *Preprocessor) EOF() bool {
+	return p.lex.Tok == SHARP && p.lex.Lit == "#"
+}
+
+// Peek returns current <token, syn>
+func (p *Preprocessor) Peek() (string, Token) {
+	return p.lex.Lit, p.lex.Tok
+}
+
+// Next returns the next <token, syn>
+func (p *Preprocessor) Next() (string, Token) {
+	p.Scan()
+	return p.Peek()
+}
+
+// Lexeme returns current token value with its position
+func (p *Preprocessor) Lexeme() Lexeme {
+	return p.lex
+}
+
+// Scan reads the next token which isn't skipped by conditionals and returns it
+func (p *Preprocessor) Scan() Lexeme {
+	for {
+		fr := p.frames[len(p.frames)-1]
+		lex := fr.scanner.Scan()
+		switch {
+		case fr.scanner.EOF():
+			for _, cond := range fr.conds {
+				p.error(cond.pos, ErrDirective, "{$ifdef} without {$endif}")
+			}
+			fr.conds = nil
+			if len(p.frames) > 1 {
+				p.frames = p.frames[:len(p.frames)-1]
+				continue
+			}
+		case lex.Tok == COMMENT && strings.HasPrefix(lex.Lit, "{$"):
+			p.directive(fr, lex)
+			continue
+		case !fr.active():
+			continue
+		case lex.Tok == COMMENT && p.mode&ScanComments == 0:
+			continue
+		}
+		p.lex = lex
+		return lex
+	}
+}
+
+// error records an error
+func (p *Preprocessor) error(pos Position, code ErrorCode, msg string) {
+	p.errors.Add(pos, code, msg)
+	p.ErrorCount++
+}
+
+// push starts to scan file f, the lexical errors in text skipped by conditionals aren't reported
+func (p *Preprocessor) push(f *File) {
+	s := NewSpecScanner(f.NewInput(), p.spec)
+	s.SetMode(p.mode | ScanComments)
+	fr := &frame{file: f, scanner: s}
+	s.SetErrorHandler(func(pos Position, code ErrorCode, msg string) {
+		if fr.active() {
+			p.error(pos, code, msg)
+		}
+	})
+	p.frames = append(p.frames, fr)
+}
+
+// active returns true if the text at current token isn't skipped by conditionals
+func (fr *frame) active() bool {
+	if len(fr.conds) == 0 {
+		return true
+	}
+	cond := fr.conds[len(fr.conds)-1]
+	return cond.outer && cond.taken != cond.elsed
+}
+
+// directive runs the directive comment lex of the file fr
+func (p *Preprocessor) directive(fr *frame, lex Lexeme) {
+	text := strings.TrimSpace(strings.TrimSuffix(lex.Lit[2:], "}"))
+	name, arg := text, ""
+	if i := strings.IndexFunc(text, IsWhitespace); i >= 0 {
+		name, arg = text[:i], strings.TrimSpace(text[i:])
+	}
+	name = strings.ToLower(name)
+	active := fr.active()
+
+	switch name {
+	case "ifdef", "ifndef":
+		if !isSymbol(arg) {
+			p.error(lex.Start, ErrDirective, "malformed {$"+name+"} symbol "+arg)
+		}
+		taken := p.defined[strings.ToLower(arg)] == (name == "ifdef")
+		fr.conds = append(fr.conds, conditional{pos: lex.Start, outer: active, taken: taken})
+	case "else":
+		if len(fr.conds) == 0 || fr.conds[len(fr.conds)-1].elsed {
+			p.error(lex.Start, ErrDirective, "{$else} without {$ifdef}")
+			return
+		}
+		fr.conds[len(fr.conds)-1].elsed = true
+	case "endif":
+		if len(fr.conds) == 0 {
+			p.error(lex.Start, ErrDirective, "{$endif} without {$ifdef}")
+			return
+		}
+		fr.conds = fr.conds[:len(fr.conds)-1]
+	case "define", "undef":
+		if !active {
+			return
+		}
+		if !isSymbol(arg) {
+			p.error(lex.Start, ErrDirective, "malformed {$"+name+"} symbol "+arg)
+			return
+		}
+		p.defined[strings.ToLower(arg)] = name == "define"
+	case "include":
+		if active {
+			p.include(fr, lex.Start, arg)
+		}
+	default:
+		if active {
+			p.error(lex.Start, ErrDirective, "unknown directive {$"+name+"}")
+		}
+	}
+}
+
+// include pushes the file name included at pos by the file fr
+func (p *Preprocessor) include(fr *frame, pos Position, name string) {
+	// the name may be quoted like a string, a quote inside is written twice
+	if len(name) >= 2 && name[0] == '\'' && name[len(name)-1] == '\'' {
+		name = strings.Replace(name[1:len(name)-1], "''", "'", -1)
+	}
+	if name == "" {
+		p.error(pos, ErrDirective, "{$include} without file name")
+		return
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(fr.file.Name()), name)
+	}
+	path := absPath(name)
+	for i, f := range p.frames {
+		if absPath(f.file.Name()) == path {
+			chain := make([]string, 0, len(p.frames)-i+1)
+			for _, f := range p.frames[i:] {
+				chain = append(chain, f.file.Name())
+			}
+			p.error(pos, ErrIncludeCycle, "include cycle "+strings.Join(append(chain, name), " -> "))
+			return
+		}
+	}
+	src, err := p.ReadFile(name)
+	if err != nil {
+		p.error(pos, ErrInclude, err.Error())
+		return
+	}
+	p.push(p.fset.AddFile(name, string(src)))
+}
+
+// absPath returns the absolute and clean form of the file name
+func absPath(name string) string {
+	if path, err := filepath.Abs(name); err == nil {
+		return path
+	}
+	return filepath.Clean(name)
+}
+
+// isSymbol returns true if str is an identifier
+func isSymbol(str string) bool {
+	for i, ch := range str {
+		if !IsLetter(ch) && (i == 0 || !IsLetterOrDigit(ch)) {
+			return false
+		}
+	}
+	return str != ""
+}
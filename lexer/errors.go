@@ -0,0 +1,156 @@
+package lexer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ErrorCode classifies the lexical errors
+type ErrorCode int
+
+const (
+	// ErrIllegalChar is a char which can't start any token
+	ErrIllegalChar ErrorCode = iota + 1
+	// ErrNumLetter is a number followed by letters such as 9x
+	ErrNumLetter
+	// ErrLeadingZero is a number with leading zeros such as 0099
+	ErrLeadingZero
+	// ErrUnknownOp is an operator which isn't in the operator table
+	ErrUnknownOp
+	// ErrInvalidUTF8 is a byte sequence which isn't valid UTF-8
+	ErrInvalidUTF8
+	// ErrUnterminatedComment is a comment without its closing delimiter
+	ErrUnterminatedComment
+	// ErrExponent is an exponent without digits such as 1e+
+	ErrExponent
+	// ErrHexDigits is a hex prefix without digits such as $
+	ErrHexDigits
+	// ErrOverflow is a number out of the int64 or float64 range
+	ErrOverflow
+	// ErrUnterminatedString is a string without its closing quote
+	ErrUnterminatedString
+	// ErrNewlineInString is a newline inside a string
+	ErrNewlineInString
+	// ErrEscape is an unknown or malformed backslash escape
+	ErrEscape
+	// ErrDirective is an unknown or malformed directive such as {$endif} without {$ifdef}
+	ErrDirective
+	// ErrInclude is an included file which can't be read
+	ErrInclude
+	// ErrIncludeCycle is a file which includes itself directly or indirectly
+	ErrIncludeCycle
+	// ErrDedent is a dedent to a column which no outer line is indented to
+	ErrDedent
+	// ErrRule is an error returned by a Rule, or a Rule which reads no chars
+	ErrRule
+	// ErrCondition is an undefined start condition or a pop of the empty condition stack
+	ErrCondition
+)
+
+var errorCodes = [...]string{
+	ErrIllegalChar: "illegal char",
+	ErrNumLetter:   "number followed by letters",
+	ErrLeadingZero: "leading zero",
+	ErrUnknownOp:   "unknown operator",
+	ErrInvalidUTF8: "invalid UTF-8 encoding",
+
+	ErrUnterminatedComment: "unterminated comment",
+	ErrExponent:            "malformed exponent",
+	ErrHexDigits:           "hex number without digits",
+	ErrOverflow:            "number overflow",
+	ErrUnterminatedString:  "unterminated string",
+	ErrNewlineInString:     "newline in string",
+	ErrEscape:              "unknown escape",
+	ErrDirective:           "malformed directive",
+	ErrInclude:             "include error",
+	ErrIncludeCycle:        "include cycle",
+	ErrDedent:              "inconsistent dedent",
+	ErrRule:                "rule error",
+	ErrCondition:           "start condition error",
+}
+
+// String returns the description of the error code
+func (code ErrorCode) String() string {
+	s := ""
+	if 0 <= code && code < ErrorCode(len(errorCodes)) {
+		s = errorCodes[code]
+	}
+	if s == "" {
+		s = "error(" + strconv.Itoa(int(code)) + ")"
+	}
+	return s
+}
+
+// Error is a lexical error with its position and code
+type Error struct {
+	Pos  Position
+	Code ErrorCode
+	Msg  string
+}
+
+// Error implements the error interface
+func (e Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ErrorHandler may be set to a Scanner,
+// it is called with the position, code and message of each lexical error
+type ErrorHandler func(pos Position, code ErrorCode, msg string)
+
+// ErrorList is a list of *Errors,
+// the zero value for an ErrorList is an empty ErrorList ready to use
+type ErrorList []*Error
+
+// Add adds an Error with given position, code and message to an ErrorList
+func (p *ErrorList) Add(pos Position, code ErrorCode, msg string) {
+	*p = append(*p, &Error{pos, code, msg})
+}
+
+// Reset resets an ErrorList to no errors
+func (p *ErrorList) Reset() {
+	*p = (*p)[0:0]
+}
+
+// ErrorList implements the sort Interface
+func (p ErrorList) Len() int      { return len(p) }
+func (p ErrorList) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+func (p ErrorList) Less(i, j int) bool {
+	e, f := p[i], p[j]
+	if e.Pos.Filename != f.Pos.Filename {
+		return e.Pos.Filename < f.Pos.Filename
+	}
+	if e.Pos.Offset != f.Pos.Offset {
+		return e.Pos.Offset < f.Pos.Offset
+	}
+	if e.Code != f.Code {
+		return e.Code < f.Code
+	}
+	return e.Msg < f.Msg
+}
+
+// Sort sorts an ErrorList by position, code and message
+func (p ErrorList) Sort() {
+	sort.Sort(p)
+}
+
+// Error implements the error interface
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
+
+// Err returns an error equivalent to this error list,
+// if the list is empty, Err returns nil
+func (p ErrorList) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
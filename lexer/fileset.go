@@ -0,0 +1,74 @@
+package lexer
+
+import (
+	"io"
+)
+
+// File is a source file of a FileSet, the positions of its inputs carry its name
+type File struct {
+	name string
+	size int
+	// src is the text of the file, it is empty for a file read from a reader
+	src string
+}
+
+// Name returns the file name
+func (f *File) Name() string {
+	return f.name
+}
+
+// Size returns the size of the file in bytes
+func (f *File) Size() int {
+	return f.size
+}
+
+// NewInput returns the input of the file, its positions carry the file name
+func (f *File) NewInput() *Input {
+	input := NewInput(f.src)
+	input.file = f
+	return input
+}
+
+// NewReaderInput returns the input of the file added by AddReaderFile which is read from rd,
+// its positions carry the file name
+func (f *File) NewReaderInput(rd io.Reader) *Input {
+	input := NewReaderInput(rd)
+	input.file = f
+	return input
+}
+
+// FileSet is a set of source files, so that the tokens and errors
+// of a program spread across several files name the file they are in
+type FileSet struct {
+	files []*File
+}
+
+// NewFileSet returns an empty file set
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// AddFile adds the file name of the program src
+func (fs *FileSet) AddFile(name, src string) *File {
+	f := fs.add(name, len(src))
+	f.src = src
+	return f
+}
+
+// AddReaderFile adds the file name of size bytes which is read by File.NewReaderInput,
+// so the file needn't be loaded into memory
+func (fs *FileSet) AddReaderFile(name string, size int) *File {
+	return fs.add(name, size)
+}
+
+// add adds the file name of size bytes
+func (fs *FileSet) add(name string, size int) *File {
+	f := &File{name: name, size: size}
+	fs.files = append(fs.files, f)
+	return f
+}
+
+// Files returns the files in the order they were added
+func (fs *FileSet) Files() []*File {
+	return fs.files
+}
@@ -0,0 +1,128 @@
+package lexer
+
+// tabWidth is the count of columns between tab stops in Layout mode
+const tabWidth = 8
+
+// layout is the state of the scanner in Layout mode
+type layout struct {
+	// indents is the stack of the indented columns, the outermost 0 isn't in it
+	indents []int
+	// parens is the depth of parentheses, the lines are joined inside them
+	parens int
+	// inLine is true after the first token of a logical line
+	inLine bool
+	// tabs is the count of extra columns of the tabs before current char in the line
+	tabs int
+	// queue holds the tokens read but not returned yet
+	queue []Lexeme
+}
+
+// readLayout returns the next token in Layout mode, a logical line ends with NEWLINE,
+// and a line indented deeper than the previous one starts with INDENT,
+// a line indented less starts with a DEDENT for each closed indentation.
+// A tab advances the indentation to the next multiple of tabWidth columns.
+// Blank lines, comments and line breaks inside parentheses don't make logical lines
+func (s *Scanner) readLayout() {
+	if len(s.layout.queue) == 0 {
+		s.scanLayout()
+	}
+	lex := s.layout.queue[0]
+	s.layout.queue = s.layout.queue[:copy(s.layout.queue, s.layout.queue[1:])]
+	s.token, s.syn, s.val = lex.Lit, lex.Tok, lex.Value
+	s.start, s.end = lex.Start, lex.End
+}
+
+// scanLayout reads a token and queues it after the layout tokens before it
+func (s *Scanner) scanLayout() {
+	l := &s.layout
+	for {
+		if nl, ok := s.skipLines(); ok && l.inLine {
+			end := Position{Filename: nl.Filename, Offset: nl.Offset + 1, Row: nl.Row + 1, Col: 1}
+			l.queue = append(l.queue, Lexeme{Tok: NEWLINE, Lit: "\n", Start: nl, End: end})
+			l.inLine = false
+		}
+		s.start = s.input.Pos()
+		s.report(s.readToken())
+		s.end = s.input.Pos()
+		if s.syn != COMMENT {
+			break
+		}
+		if s.end.Row != s.start.Row {
+			// the tabs were on a line the comment ended
+			l.tabs = 0
+		}
+		if s.mode&ScanComments != 0 {
+			l.queue = append(l.queue, s.Lexeme())
+			return
+		}
+	}
+
+	switch {
+	case s.syn == SHARP:
+		// the last line ends as if the program ended with '\n', and all indentations are closed
+		if l.inLine {
+			end := Position{Filename: s.start.Filename, Offset: s.start.Offset + 1, Row: s.start.Row + 1, Col: 1}
+			l.queue = append(l.queue, Lexeme{Tok: NEWLINE, Lit: "\n", Start: s.start, End: end})
+		}
+		for range l.indents {
+			l.queue = append(l.queue, Lexeme{Tok: DEDENT, Start: s.start, End: s.start})
+		}
+		l.indents, l.inLine = l.indents[:0], false
+	case !l.inLine:
+		s.indent(s.start.Col - 1 + l.tabs)
+		l.inLine = true
+	}
+	switch s.syn {
+	case LPAREN:
+		l.parens++
+	case RPAREN:
+		if l.parens > 0 {
+			l.parens--
+		}
+	}
+	l.queue = append(l.queue, s.Lexeme())
+}
+
+// skipLines skips whitespace and returns the position of the first '\n' outside parentheses,
+// it counts the extra columns of the tabs in the last line
+func (s *Scanner) skipLines() (Position, bool) {
+	l := &s.layout
+	var nl Position
+	found := false
+	for ch := s.input.Peek(); IsWhitespace(ch); ch, _ = s.input.Next() {
+		switch ch {
+		case '\n':
+			if !found && l.parens == 0 {
+				nl, found = s.input.Pos(), true
+			}
+			l.tabs = 0
+		case '\t':
+			col := s.input.col - 1 + l.tabs
+			l.tabs += tabWidth - col%tabWidth - 1
+		}
+	}
+	return nl, found
+}
+
+// indent queues INDENT or DEDENTs for the first token of a line at column col
+func (s *Scanner) indent(col int) {
+	l := &s.layout
+	top := func() int {
+		if len(l.indents) == 0 {
+			return 0
+		}
+		return l.indents[len(l.indents)-1]
+	}
+	if col > top() {
+		l.indents = append(l.indents, col)
+		l.queue = append(l.queue, Lexeme{Tok: INDENT, Start: s.start, End: s.start})
+		return
+	}
+	for col < top() {
+		l.indents = l.indents[:len(l.indents)-1]
+		l.queue = append(l.queue, Lexeme{Tok: DEDENT, Start: s.start, End: s.start})
+	}
+	if col != top() {
+		s.error(s.start, ErrDedent, "dedent doesn't match any outer indentation")
+	}
+}
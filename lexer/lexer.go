@@ -1,9 +1,13 @@
 package lexer
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
+	"io"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // keywords: begin  if  then  while  do  end
@@ -11,8 +15,12 @@ import (
 // ID = letter (letter | digit)*
 // NUM = digit digit*
 // ID = [a-zA-Z_$][a-zA-Z_$0-9]*
-// NUM = [0-9] | [1-9][0-9]*
+// INTNUM = [0-9] | [1-9][0-9]* | $[0-9a-fA-F]+ | 0[xX][0-9a-fA-F]+
+// REALNUM = INTNUM.[0-9]+ ([eE][+-]?[0-9]+)? | INTNUM[eE][+-]?[0-9]+
+// STRING = '...' in which a quote is doubled as '', CHAR is a STRING of one char
 // whitespace = [ \t\n]
+// comment = { ... } | (* ... *) | // ... which may be nested except the line comment
+// directive = {$name arg} which is a comment expanded by Preprocessor
 
 // Token is the set of lexical tokens
 type Token int
@@ -48,8 +56,8 @@ const (
 	_
 	// data type
 	ID
-	NUM
-	_
+	INTNUM
+	REALNUM
 	// op type
 	ADD    // +
 	SUB    // -
@@ -69,9 +77,24 @@ const (
 	LPAREN   // (
 	RPAREN   // )
 
+	// STRING and CHAR are the quoted literals
+	STRING
+	CHAR
+	// ILLEGAL is the text skipped by the scanner for lexical errors
+	ILLEGAL
+	// COMMENT is only returned in ScanComments mode
+	COMMENT
+	// NEWLINE, INDENT and DEDENT are only returned in Layout mode
+	NEWLINE
+	INDENT
+	DEDENT
+
 	EPISILON // represents the null and is the seperation between lex and syntax
 )
 
+// NUM is the old name of INTNUM
+const NUM = INTNUM
+
 var tokens = [...]string{
 	SHARP:    "#",
 	BEGIN:    "begin",
@@ -81,7 +104,8 @@ var tokens = [...]string{
 	DO:       "do",
 	END:      "end",
 	ID:       "id",
-	NUM:      "num",
+	INTNUM:   "intnum",
+	REALNUM:  "realnum",
 	ADD:      "+",
 	SUB:      "-",
 	MUL:      "*",
@@ -97,51 +121,149 @@ var tokens = [...]string{
 	SEMCOLON: ";",
 	LPAREN:   "(",
 	RPAREN:   ")",
+	STRING:   "string",
+	CHAR:     "char",
+	ILLEGAL:  "illegal",
+	COMMENT:  "comment",
+	NEWLINE:  "newline",
+	INDENT:   "indent",
+	DEDENT:   "dedent",
 }
 
-var keywords map[string]Token
-
-// init will be called before main function
-func init() {
-	keywords = make(map[string]Token)
-	for i := SHARP; i <= RPAREN; i++ {
-		keywords[tokens[i]] = i
-	}
-}
-
-// Input records the lex position
+// Input records the lex position over a buffered program reader
 type Input struct {
 	position, row, col int
-	program            string
+	rd                 io.Reader
+	buf                []byte // buffered window of the program
+	src                string // the program when it is all in memory
+	file               *File  // the file of the program in a FileSet, or nil
+	base               int    // offset of buf[0] in the program
+	err                error  // sticky read error, io.EOF when rd is drained
+	cols               []int  // cols of the last '\n's passed by Next, restored by Back
 }
 
+const (
+	// minRead is the least free space offered to a single rd.Read
+	minRead = 512
+	// backSize is the count of read bytes kept for Back
+	backSize = 1024
+)
+
 // NewInput returns the object for program's position record
 func NewInput(program string) *Input {
-	if program[len(program)-1] != '#' {
-		program += "#"
+	// the whole program is already in memory, so it is the buffer itself
+	program = strings.TrimSuffix(program, "#")
+	return &Input{
+		position: 0,
+		row:      1,
+		col:      1,
+		buf:      []byte(program),
+		src:      program,
+		err:      io.EOF,
 	}
+}
+
+// NewReaderInput returns the object for position record of a program read from rd,
+// the program is buffered incrementally so it needn't be loaded into memory at once
+func NewReaderInput(rd io.Reader) *Input {
 	return &Input{
 		position: 0,
 		row:      1,
 		col:      1,
-		program:  program,
+		rd:       rd,
+	}
+}
+
+// fill reads from rd until the byte at offset is buffered,
+// it returns false when the program ends before offset
+func (i *Input) fill(offset int) bool {
+	for offset-i.base >= len(i.buf) {
+		if i.err != nil {
+			return false
+		}
+		i.compact()
+		if cap(i.buf)-len(i.buf) < minRead {
+			buf := make([]byte, len(i.buf), 2*cap(i.buf)+minRead)
+			copy(buf, i.buf)
+			i.buf = buf
+		}
+		n, err := i.rd.Read(i.buf[len(i.buf):cap(i.buf)])
+		i.buf = i.buf[:len(i.buf)+n]
+		if err != nil {
+			i.err = err
+		}
+	}
+	return true
+}
+
+// compact drops the bytes that Back can't reach any more
+func (i *Input) compact() {
+	drop := i.position - backSize - i.base
+	if drop <= 0 || drop < len(i.buf)/2 {
+		return
+	}
+	n := copy(i.buf, i.buf[drop:])
+	i.buf = i.buf[:n]
+	i.base += drop
+}
+
+// Err returns the first non-EOF error met while reading the program
+func (i *Input) Err() error {
+	if i.err == io.EOF {
+		return nil
 	}
+	return i.err
 }
 
 // EOF returns true when program gets to the end
 func (i *Input) EOF() bool {
-	return i.position >= len(i.program)-1
+	return i.position-i.base >= len(i.buf) && !i.fill(i.position)
 }
 
-// Peek returns current position char
-func (i *Input) Peek() byte {
+// peek decodes the char at current position and returns it with its width in bytes
+func (i *Input) peek() (rune, int) {
+	// fast path of ASCII chars in the buffer window
+	if j := i.position - i.base; j < len(i.buf) && i.buf[j] < utf8.RuneSelf {
+		return rune(i.buf[j]), 1
+	}
 	if i.EOF() {
-		return '#'
+		return '#', 0
+	}
+	if ch := i.buf[i.position-i.base]; ch < utf8.RuneSelf {
+		return rune(ch), 1
+	}
+	i.fill(i.position + utf8.UTFMax - 1)
+	return utf8.DecodeRune(i.buf[i.position-i.base:])
+}
+
+// Peek returns current position char
+func (i *Input) Peek() rune {
+	ch, _ := i.peek()
+	return ch
+}
+
+// Invalid returns true if current char is not a valid UTF-8 encoding
+func (i *Input) Invalid() bool {
+	ch, width := i.peek()
+	return ch == utf8.RuneError && width == 1
+}
+
+// raw returns the bytes of current char in the buffer window
+func (i *Input) raw() []byte {
+	_, width := i.peek()
+	return i.buf[i.position-i.base : i.position-i.base+width]
+}
+
+// slice returns the program text from offset start to current position without copying,
+// it returns false unless the whole program is in memory
+func (i *Input) slice(start int) (string, bool) {
+	if i.rd != nil {
+		return "", false
 	}
-	return i.program[i.position]
+	return i.src[start:i.position], true
 }
 
-// SkipWhitespace will skip ' \t\n'
+// SkipWhitespace will skip ' \t\n' and other unicode spaces
 func (i *Input) SkipWhitespace() {
 	ch := i.Peek()
 	for IsWhitespace(ch) {
@@ -149,59 +271,103 @@ func (i *Input) SkipWhitespace() {
 	}
 }
 
-// Next returns the next char
-func (i *Input) Next() (byte, error) {
-	if i.EOF() {
+// Next returns the next char, the col is counted in chars
+func (i *Input) Next() (rune, error) {
+	ch, width := i.peek()
+	if width == 0 {
 		return '#', errors.New("EOF")
 	}
-	i.position++
-	if i.program[i.position] == '\n' {
+	// the row ends after its '\n'
+	if ch == '\n' {
+		if len(i.cols) == 2*backSize {
+			// Back can't reach the older ones
+			i.cols = i.cols[:copy(i.cols, i.cols[backSize:])]
+		}
+		i.cols = append(i.cols, i.col)
 		i.row++
-		i.col = 0
+		i.col = 1
 	} else {
 		i.col++
 	}
-	return i.program[i.position], nil
+	i.position += width
+	return i.Peek(), nil
 }
 
-// Back returns the prev char
-func (i *Input) Back() (byte, error) {
+// Back returns the prev char, it can only go back within the buffer window
+func (i *Input) Back() (rune, error) {
 	if i.position == 0 {
-		return i.program[0], nil
+		return i.Peek(), nil
+	}
+	if i.position <= i.base {
+		return i.Peek(), errors.New("back out of the buffer window")
 	}
-	i.position--
-	if i.program[i.position] == '\n' {
+	ch, width := utf8.DecodeLastRune(i.buf[:i.position-i.base])
+	i.position -= width
+	if ch == '\n' {
 		i.row--
-		i.col = 0
+		if n := len(i.cols); n > 0 {
+			i.col, i.cols = i.cols[n-1], i.cols[:n-1]
+		} else {
+			// the input didn't pass the '\n', count the col from the prev '\n' in the program
+			line := i.buf[:i.position-i.base]
+			if j := bytes.LastIndexByte(line, '\n'); j >= 0 {
+				line = line[j+1:]
+			}
+			i.col = utf8.RuneCount(line) + 1
+		}
 	} else {
 		i.col--
 	}
-	return i.program[i.position], nil
+	return ch, nil
+}
+
+// Pos returns the position of current char
+func (i *Input) Pos() Position {
+	var name string
+	if i.file != nil {
+		name = i.file.name
+	}
+	return Position{
+		Filename: name,
+		Offset:   i.position,
+		Row:      i.row,
+		Col:      i.col,
+	}
 }
 
-// Collapse returns error message for lex error
-func (i *Input) Collapse(msg string) error {
-	return fmt.Errorf("Error:%s row:%d col:%d", msg, i.row, i.col)
+// File returns the file of the program in a FileSet, or nil if it's not in one
+func (i *Input) File() *File {
+	return i.file
 }
 
-// IsLetter returns true if ch is letter
-func IsLetter(ch byte) bool {
+// IsLetter returns true if ch is a unicode letter
+func IsLetter(ch rune) bool {
 	if ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' {
 		return true
 	}
-	return false
+	return ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-// IsDigit returns true if ch is a digit
-func IsDigit(ch byte) bool {
+// IsDigit returns true if ch is a decimal digit of numbers
+func IsDigit(ch rune) bool {
 	if ch >= '0' && ch <= '9' {
 		return true
 	}
 	return false
 }
 
+// IsHexDigit returns true if ch is a hex digit
+func IsHexDigit(ch rune) bool {
+	return IsDigit(ch) || ch >= 'a' && ch <= 'f' || ch >= 'A' && ch <= 'F'
+}
+
+// IsLetterOrDigit returns true if ch may be a char of identifiers but the first
+func IsLetterOrDigit(ch rune) bool {
+	return IsLetter(ch) || IsDigit(ch) || ch >= utf8.RuneSelf && unicode.IsDigit(ch)
+}
+
 // IsOpChar returns true if ch is the first char of some operators or delimiters
-func IsOpChar(ch byte) bool {
+func IsOpChar(ch rune) bool {
 	switch ch {
 	case ':', '+', '-', '*', '/', '<', '>', '=', ';', '(', ')':
 		return true
@@ -210,10 +376,10 @@ func IsOpChar(ch byte) bool {
 }
 
 // IsWhitespace returns true if ch is whitespace
-func IsWhitespace(ch byte) bool {
+func IsWhitespace(ch rune) bool {
 	switch ch {
 	case ' ', '\t', '\r', '\n':
 		return true
 	}
-	return false
+	return ch >= utf8.RuneSelf && unicode.IsSpace(ch)
 }
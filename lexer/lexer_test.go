@@ -0,0 +1,822 @@
+package lexer
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const testProgram = `begin x:=9; if x>9 then x:=2*x+1/3; end #`
+
+// scanAll collects all <token, syn> until '#'
+func scanAll(s TokenSource) (toks []string, syns []Token) {
+	for {
+		tok, syn := s.Next()
+		toks = append(toks, tok)
+		syns = append(syns, syn)
+		if s.EOF() {
+			return
+		}
+	}
+}
+
+// checkTokens reports the <token, syn> which aren't the expected ones, a nil wantToks checks only the syns
+func checkTokens(t *testing.T, toks []string, syns []Token, wantToks []string, wantSyns []Token) {
+	t.Helper()
+	if wantToks != nil && !reflect.DeepEqual(toks, wantToks) {
+		t.Errorf("got tokens %q, expected %q", toks, wantToks)
+	}
+	if !reflect.DeepEqual(syns, wantSyns) {
+		t.Errorf("got syns %v, expected %v", syns, wantSyns)
+	}
+}
+
+func TestReaderInput(t *testing.T) {
+	wantToks, wantSyns := scanAll(NewScanner(NewInput(testProgram)))
+	rd := iotest.OneByteReader(strings.NewReader(testProgram))
+	toks, syns := scanAll(NewScanner(NewReaderInput(rd)))
+	checkTokens(t, toks, syns, wantToks, wantSyns)
+}
+
+func TestReaderInputBack(t *testing.T) {
+	// a program larger than the buffer window
+	program := strings.Repeat("x ", 4*backSize)
+	input := NewReaderInput(iotest.HalfReader(strings.NewReader(program)))
+	n := 0
+	for !input.EOF() {
+		input.Next()
+		n++
+	}
+	if n != len(program) {
+		t.Fatalf("read %d chars, expected %d", n, len(program))
+	}
+	for k := 0; k < backSize; k++ {
+		if _, err := input.Back(); err != nil {
+			t.Fatalf("Back %d failed: %v", k, err)
+		}
+	}
+	if ch := input.Peek(); ch != rune(program[len(program)-backSize]) {
+		t.Errorf("Peek after Back got %q, expected %q", ch, program[len(program)-backSize])
+	}
+}
+
+func TestReaderInputBackLine(t *testing.T) {
+	// the start of the first line drops out of the buffer window
+	program := strings.Repeat("x", 4*backSize) + "\n" + strings.Repeat("y", 2*backSize)
+	input := NewReaderInput(iotest.HalfReader(strings.NewReader(program)))
+	for k := 0; k < 4*backSize+backSize/2; k++ {
+		input.Next()
+	}
+	if input.base == 0 {
+		t.Fatal("the buffer window wasn't compacted")
+	}
+	for k := 0; k < backSize/2; k++ {
+		input.Back()
+	}
+	if pos := input.Pos(); pos.Row != 1 || pos.Col != 4*backSize+1 {
+		t.Errorf("Back over '\\n' got %d:%d, expected 1:%d", pos.Row, pos.Col, 4*backSize+1)
+	}
+}
+
+func TestScanPosition(t *testing.T) {
+	s := NewScanner(NewInput("begin\n  x := 10;\nend"))
+	want := []Lexeme{
+		{BEGIN, "begin", Position{"", 0, 1, 1}, Position{"", 5, 1, 6}, nil},
+		{ID, "x", Position{"", 8, 2, 3}, Position{"", 9, 2, 4}, nil},
+		{ASSIGN, ":=", Position{"", 10, 2, 5}, Position{"", 12, 2, 7}, nil},
+		{INTNUM, "10", Position{"", 13, 2, 8}, Position{"", 15, 2, 10}, int64(10)},
+		{SEMCOLON, ";", Position{"", 15, 2, 10}, Position{"", 16, 2, 11}, nil},
+		{END, "end", Position{"", 17, 3, 1}, Position{"", 20, 3, 4}, nil},
+		{SHARP, "#", Position{"", 20, 3, 4}, Position{"", 20, 3, 4}, nil},
+	}
+	for i, w := range want {
+		if lex := s.Scan(); lex != w {
+			t.Errorf("lexeme %d: got %+v, expected %+v", i, lex, w)
+		}
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	s := NewScanner(NewInput("9x9x 0099 ??@@ x :> 0a #"))
+	var handled int
+	s.SetErrorHandler(func(pos Position, code ErrorCode, msg string) {
+		handled++
+	})
+	toks, syns := scanAll(s)
+	wantToks := []string{"9x9x", "0099", "??@@", "x", ":", ">", "0a", "#"}
+	wantSyns := []Token{ILLEGAL, ILLEGAL, ILLEGAL, ID, COLON, GTR, ILLEGAL, SHARP}
+	checkTokens(t, toks, syns, wantToks, wantSyns)
+	want := []struct {
+		col  int
+		code ErrorCode
+	}{
+		{1, ErrNumLetter},
+		{6, ErrLeadingZero},
+		{11, ErrIllegalChar},
+		{21, ErrNumLetter},
+	}
+	errs := s.Errors()
+	if len(errs) != len(want) || handled != len(want) || s.ErrorCount != len(want) {
+		t.Fatalf("got %d errors (%d handled), expected %d: %v", len(errs), handled, len(want), errs)
+	}
+	for i, w := range want {
+		if errs[i].Pos.Col != w.col || errs[i].Code != w.code {
+			t.Errorf("error %d: got %v %v, expected col %d %v", i, errs[i], errs[i].Code, w.col, w.code)
+		}
+	}
+}
+
+func TestScanLongIllegal(t *testing.T) {
+	garbage := strings.Repeat("?", 1<<20)
+	s := NewScanner(NewInput(garbage + " x"))
+	if lex := s.Scan(); lex.Tok != ILLEGAL || lex.End.Offset != len(garbage) {
+		t.Errorf("got %v ending at %d, expected ILLEGAL ending at %d", lex.Tok, lex.End.Offset, len(garbage))
+	}
+	if _, syn := s.Next(); syn != ID {
+		t.Errorf("got %v after garbage, expected id", syn)
+	}
+}
+
+func TestScanUnicode(t *testing.T) {
+	s := NewScanner(NewInput("begin 变量1 := café;\n\xff\xfe é2 end"))
+	want := []Lexeme{
+		{BEGIN, "begin", Position{"", 0, 1, 1}, Position{"", 5, 1, 6}, nil},
+		{ID, "变量1", Position{"", 6, 1, 7}, Position{"", 13, 1, 10}, nil},
+		{ASSIGN, ":=", Position{"", 15, 1, 11}, Position{"", 17, 1, 13}, nil},
+		{ID, "café", Position{"", 18, 1, 14}, Position{"", 23, 1, 18}, nil},
+		{SEMCOLON, ";", Position{"", 23, 1, 18}, Position{"", 24, 1, 19}, nil},
+		{ILLEGAL, "\xff\xfe", Position{"", 25, 2, 1}, Position{"", 27, 2, 3}, nil},
+		{ID, "é2", Position{"", 28, 2, 4}, Position{"", 31, 2, 6}, nil},
+		{END, "end", Position{"", 32, 2, 7}, Position{"", 35, 2, 10}, nil},
+	}
+	for i, w := range want {
+		if lex := s.Scan(); lex != w {
+			t.Errorf("lexeme %d: got %+v, expected %+v", i, lex, w)
+		}
+	}
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Code != ErrInvalidUTF8 {
+		t.Errorf("got errors %v, expected one invalid UTF-8 error", errs)
+	}
+}
+
+func TestInputBackRune(t *testing.T) {
+	input := NewInput("ab\n变量")
+	for !input.EOF() {
+		input.Next()
+	}
+	for _, want := range []Position{{"", 6, 2, 2}, {"", 3, 2, 1}, {"", 2, 1, 3}, {"", 1, 1, 2}} {
+		input.Back()
+		if pos := input.Pos(); pos != want {
+			t.Errorf("Back got %+v, expected %+v", pos, want)
+		}
+	}
+}
+
+func TestScanComments(t *testing.T) {
+	program := "x { a { b } (* c *) } := (* { *) } *) 1 // line\n(y)"
+	toks, _ := scanAll(NewScanner(NewInput(program)))
+	want := []string{"x", ":=", "1", "(", "y", ")", "#"}
+	if strings.Join(toks, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, expected %q", toks, want)
+	}
+
+	s := NewScanner(NewInput(program))
+	s.SetMode(ScanComments)
+	var comments []string
+	for lex := s.Scan(); lex.Tok != SHARP; lex = s.Scan() {
+		if lex.Tok == COMMENT {
+			comments = append(comments, lex.Lit)
+		}
+	}
+	want = []string{"{ a { b } (* c *) }", "(* { *) } *)", "// line"}
+	if strings.Join(comments, "|") != strings.Join(want, "|") {
+		t.Errorf("got comments %q, expected %q", comments, want)
+	}
+
+	// only (* and // start comments of ( and /
+	for program, want := range map[string][]string{
+		"x := (/2)": {"x", ":=", "(", "/", "2", ")", "#"},
+		"a/*b":      {"a", "/", "*", "b", "#"},
+	} {
+		s := NewScanner(NewInput(program))
+		if toks, _ := scanAll(s); strings.Join(toks, " ") != strings.Join(want, " ") || len(s.Errors()) != 0 {
+			t.Errorf("%q: got %q with errors %v, expected %q", program, toks, s.Errors(), want)
+		}
+	}
+}
+
+func TestScanUnterminatedComment(t *testing.T) {
+	s := NewScanner(NewInput("x\n  (* a { b } "))
+	toks, _ := scanAll(s)
+	if len(toks) != 2 {
+		t.Errorf("got %q, expected [x #]", toks)
+	}
+	errs := s.Errors()
+	if len(errs) != 1 || errs[0].Code != ErrUnterminatedComment || errs[0].Pos != (Position{"", 4, 2, 3}) {
+		t.Errorf("got errors %v, expected an unterminated comment at 2:3", errs)
+	}
+}
+
+func TestScanNumbers(t *testing.T) {
+	program := "0 10 3.14 1e-9 2.5E+3 $FF 0x1F 1..9 0.5e1 9223372036854775807"
+	want := []Lexeme{
+		{Tok: INTNUM, Lit: "0", Value: int64(0)},
+		{Tok: INTNUM, Lit: "10", Value: int64(10)},
+		{Tok: REALNUM, Lit: "3.14", Value: 3.14},
+		{Tok: REALNUM, Lit: "1e-9", Value: 1e-9},
+		{Tok: REALNUM, Lit: "2.5E+3", Value: 2.5e3},
+		{Tok: INTNUM, Lit: "$FF", Value: int64(255)},
+		{Tok: INTNUM, Lit: "0x1F", Value: int64(31)},
+		{Tok: INTNUM, Lit: "1", Value: int64(1)},
+		{Tok: ILLEGAL, Lit: ".."},
+		{Tok: INTNUM, Lit: "9", Value: int64(9)},
+		{Tok: REALNUM, Lit: "0.5e1", Value: 5.0},
+		{Tok: INTNUM, Lit: "9223372036854775807", Value: int64(9223372036854775807)},
+	}
+	s := NewScanner(NewInput(program))
+	for i, w := range want {
+		lex := s.Scan()
+		if lex.Tok != w.Tok || lex.Lit != w.Lit || lex.Value != w.Value {
+			t.Errorf("lexeme %d: got %v %v, expected %v %v", i, lex, lex.Value, w, w.Value)
+		}
+	}
+}
+
+func TestScanNumberErrors(t *testing.T) {
+	program := "1e+ 2.5Ex $ 0xG 9223372036854775808 1e400 $8000000000000000"
+	want := []ErrorCode{ErrExponent, ErrExponent, ErrHexDigits, ErrNumLetter, ErrOverflow, ErrOverflow, ErrOverflow}
+	s := NewScanner(NewInput(program))
+	toks, syns := scanAll(s)
+	for i := range want {
+		if syns[i] != ILLEGAL {
+			t.Errorf("token %d: got <%s, %v>, expected illegal", i, toks[i], syns[i])
+		}
+	}
+	errs := s.Errors()
+	if len(errs) != len(want) {
+		t.Fatalf("got errors %v, expected %v", errs, want)
+	}
+	for i, code := range want {
+		if errs[i].Code != code {
+			t.Errorf("error %d: got %v, expected %v", i, errs[i].Code, code)
+		}
+	}
+}
+
+func TestScanStrings(t *testing.T) {
+	program := `'hello' 'it''s' 'x' '''' '' '中' 'a\nb'`
+	want := []Lexeme{
+		{Tok: STRING, Lit: `'hello'`, Value: "hello"},
+		{Tok: STRING, Lit: `'it''s'`, Value: "it's"},
+		{Tok: CHAR, Lit: `'x'`, Value: 'x'},
+		{Tok: CHAR, Lit: `''''`, Value: '\''},
+		{Tok: STRING, Lit: `''`, Value: ""},
+		{Tok: CHAR, Lit: `'中'`, Value: '中'},
+		{Tok: STRING, Lit: `'a\nb'`, Value: `a\nb`},
+	}
+	s := NewScanner(NewInput(program))
+	for i, w := range want {
+		lex := s.Scan()
+		if lex.Tok != w.Tok || lex.Lit != w.Lit || lex.Value != w.Value {
+			t.Errorf("lexeme %d: got %v %#v, expected %v %#v", i, lex, lex.Value, w, w.Value)
+		}
+	}
+
+	s = NewScanner(NewInput(`'a\nb' '\x41中\'' '\q'`))
+	s.SetMode(BackslashEscapes)
+	for i, w := range []interface{}{"a\nb", "A中'", nil} {
+		if lex := s.Scan(); lex.Value != w {
+			t.Errorf("escaped lexeme %d: got %v %#v, expected %#v", i, lex, lex.Value, w)
+		}
+	}
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Code != ErrEscape || errs[0].Pos.Col != 19 {
+		t.Errorf("got errors %v, expected an unknown escape at 1:19", errs)
+	}
+}
+
+func TestScanStringErrors(t *testing.T) {
+	s := NewScanner(NewInput("x := 'abc\n  'de"))
+	toks, syns := scanAll(s)
+	if len(toks) != 5 || syns[2] != ILLEGAL || toks[2] != "'abc" || syns[3] != ILLEGAL {
+		t.Errorf("got %q %v", toks, syns)
+	}
+	want := []Error{
+		{Position{"", 9, 1, 10}, ErrNewlineInString, ""},
+		{Position{"", 12, 2, 3}, ErrUnterminatedString, ""},
+	}
+	errs := s.Errors()
+	if len(errs) != len(want) {
+		t.Fatalf("got errors %v, expected %d", errs, len(want))
+	}
+	for i, w := range want {
+		if errs[i].Pos != w.Pos || errs[i].Code != w.Code {
+			t.Errorf("error %d: got %v %v, expected %v %v", i, errs[i], errs[i].Code, w.Pos, w.Code)
+		}
+	}
+}
+
+func TestScanIgnoreCase(t *testing.T) {
+	program := "BEGIN Begin x := Foo; FOO End"
+	s := NewScanner(NewInput(program))
+	s.SetMode(IgnoreCase | FoldIdents)
+	want := []Lexeme{
+		{Tok: BEGIN, Lit: "BEGIN"}, {Tok: BEGIN, Lit: "Begin"}, {Tok: ID, Lit: "x", Value: "x"},
+		{Tok: ASSIGN, Lit: ":="}, {Tok: ID, Lit: "Foo", Value: "foo"}, {Tok: SEMCOLON, Lit: ";"},
+		{Tok: ID, Lit: "FOO", Value: "foo"}, {Tok: END, Lit: "End"}, {Tok: SHARP, Lit: "#"},
+	}
+	for i, w := range want {
+		lex := s.Scan()
+		if lex.Tok != w.Tok || lex.Lit != w.Lit || lex.Value != w.Value {
+			t.Errorf("token %d: got %v %v, expected %v %v", i, lex, lex.Value, w, w.Value)
+		}
+	}
+
+	// exact case by default
+	_, syns := scanAll(NewScanner(NewInput(program)))
+	if syns[0] != ID || syns[1] != ID || syns[7] != ID {
+		t.Errorf("got %v, expected ids", syns)
+	}
+}
+
+func TestScanLayout(t *testing.T) {
+	program := "while x do\n" +
+		"    y := (1 +\n" +
+		"  2)\n" +
+		"\n" +
+		"    // note\n" +
+		"    if y then\n" +
+		"        z := 1\n" +
+		"  w := 2\n" +
+		"end\n" +
+		"if x then\n" +
+		"  x := 0"
+	s := NewScanner(NewInput(program))
+	s.SetMode(Layout)
+	_, syns := scanAll(s)
+	want := []Token{WHILE, ID, DO, NEWLINE,
+		INDENT, ID, ASSIGN, LPAREN, INTNUM, ADD, INTNUM, RPAREN, NEWLINE,
+		IF, ID, THEN, NEWLINE,
+		INDENT, ID, ASSIGN, INTNUM, NEWLINE,
+		DEDENT, DEDENT, ID, ASSIGN, INTNUM, NEWLINE,
+		END, NEWLINE,
+		IF, ID, THEN, NEWLINE,
+		INDENT, ID, ASSIGN, INTNUM, NEWLINE, DEDENT, SHARP}
+	checkTokens(t, nil, syns, nil, want)
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Code != ErrDedent || errs[0].Pos.Row != 8 {
+		t.Errorf("got errors %v, expected an inconsistent dedent at row 8", errs)
+	}
+
+	// the NEWLINE is the '\n' ending the logical line
+	s = NewScanner(NewInput("x\n\ny"))
+	s.SetMode(Layout)
+	if lex := s.Scan(); lex.Tok != ID {
+		t.Errorf("got %v, expected x", lex)
+	}
+	if lex := s.Scan(); lex.Tok != NEWLINE || lex.Start.Offset != 1 || lex.End.Row != 2 {
+		t.Errorf("got %v, expected newline at 1:2", lex)
+	}
+	// the last line ends as if the program ended with '\n'
+	s.Scan()
+	want1 := Lexeme{Tok: NEWLINE, Lit: "\n", Start: Position{Offset: 4, Row: 3, Col: 2}, End: Position{Offset: 5, Row: 4, Col: 1}}
+	if lex := s.Scan(); lex != want1 {
+		t.Errorf("got %+v, expected %+v", lex, want1)
+	}
+
+	// a tab advances to the next multiple of 8 columns
+	for _, test := range []struct {
+		program string
+		want    []Token
+	}{
+		{"if x then\n\ty := 1\n        z := 2\n",
+			[]Token{IF, ID, THEN, NEWLINE, INDENT, ID, ASSIGN, INTNUM, NEWLINE, ID, ASSIGN, INTNUM, NEWLINE, DEDENT, SHARP}},
+		{"  \tx\n\ty\n", []Token{INDENT, ID, NEWLINE, ID, NEWLINE, DEDENT, SHARP}},
+		{"    x\n  \ty\n", []Token{INDENT, ID, NEWLINE, INDENT, ID, NEWLINE, DEDENT, DEDENT, SHARP}},
+	} {
+		s := NewScanner(NewInput(test.program))
+		s.SetMode(Layout)
+		_, syns := scanAll(s)
+		if !reflect.DeepEqual(syns, test.want) || len(s.Errors()) != 0 {
+			t.Errorf("%q: got %v with errors %v, expected %v", test.program, syns, s.Errors(), test.want)
+		}
+	}
+}
+
+func TestSpecScanner(t *testing.T) {
+	spec := DefaultSpec()
+	integer := spec.Keyword("integer", spec.Define("integer"))
+	dotdot := spec.Operator("..", spec.Define(".."))
+	if integer < EPISILON || dotdot != integer+1 || spec.Epsilon() != dotdot+1 {
+		t.Errorf("got tokens %d %d and epsilon %d after %d", integer, dotdot, spec.Epsilon(), EPISILON)
+	}
+	if name := spec.TokenString(dotdot); name != ".." {
+		t.Errorf("got name %s, expected ..", name)
+	}
+
+	s := NewSpecScanner(NewInput("x: integer; 1..9 . begin"), spec)
+	_, syns := scanAll(s)
+	want := []Token{ID, COLON, integer, SEMCOLON, INTNUM, dotdot, INTNUM, ILLEGAL, BEGIN, SHARP}
+	checkTokens(t, nil, syns, nil, want)
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Code != ErrUnknownOp {
+		t.Errorf("got errors %v, expected an unknown operator", errs)
+	}
+	lex := Lexeme{Tok: integer, Lit: "integer", Start: Position{"", 3, 1, 4}}
+	if str := s.Spec().LexemeString(lex); str != "<'integer', integer> 1:4" {
+		t.Errorf("got %s, expected the name of integer", str)
+	}
+
+	// the default spec isn't changed
+	if _, syn := NewScanner(NewInput("integer")).Next(); syn != ID {
+		t.Errorf("got %v from default scanner, expected id", syn)
+	}
+}
+
+func TestScanOperators(t *testing.T) {
+	spec := DefaultSpec()
+	dotdot := spec.Operator("..", spec.Define(".."))
+	ellipsis := spec.Operator("...", spec.Define("..."))
+	pow := spec.Operator("**", spec.Define("**"))
+	shr := spec.Operator(">>=", spec.Define(">>="))
+	s := NewSpecScanner(NewInput("a...b >> c>>=1**2 ..= x.y :=<><="), spec)
+	toks, syns := scanAll(s)
+	wantToks := []string{"a", "...", "b", ">", ">", "c", ">>=", "1", "**", "2", "..", "=", "x", ".", "y", ":=", "<>", "<=", "#"}
+	wantSyns := []Token{ID, ellipsis, ID, GTR, GTR, ID, shr, INTNUM, pow, INTNUM, dotdot, EQ, ID, ILLEGAL, ID, ASSIGN, NEQ, LEQ, SHARP}
+	checkTokens(t, toks, syns, wantToks, wantSyns)
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Code != ErrUnknownOp || errs[0].Pos.Col != 24 {
+		t.Errorf("got errors %v, expected an unknown operator at 1:24", errs)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	spec := DefaultSpec()
+	pragma, endPragma := spec.Define("{$"), spec.Define("}")
+	s := NewSpecScanner(NewInput("x {$define DEBUG ?} { comment } y {$ifdef"), spec)
+	pragmaAhead := func(s *Scanner) bool {
+		if s.Input().Peek() != '{' {
+			return false
+		}
+		ch, _ := s.Input().Next()
+		s.Input().Back()
+		return ch == '$'
+	}
+	s.DefineCondition(Initial, Condition{Rules: append([]Rule{{
+		Start: pragmaAhead,
+		Read: func(s *Scanner) error {
+			s.Take()
+			s.Take()
+			s.Emit(pragma, nil)
+			s.PushCondition("pragma")
+			return nil
+		},
+	}}, DefaultRules()...)})
+	s.DefineCondition("pragma", Condition{Rules: []Rule{{
+		Start: func(s *Scanner) bool { return IsLetter(s.Input().Peek()) },
+		Read: func(s *Scanner) error {
+			for IsLetter(s.Input().Peek()) {
+				s.Take()
+			}
+			s.Emit(ID, strings.ToLower(s.Text()))
+			return nil
+		},
+	}, {
+		Start: peekIs('}'),
+		Read: func(s *Scanner) error {
+			s.Take()
+			s.Emit(endPragma, nil)
+			s.PopCondition()
+			return nil
+		},
+	}}})
+
+	toks, syns := scanAll(s)
+	wantToks := []string{"x", "{$", "define", "DEBUG", "?", "}", "y", "{$", "ifdef", "#"}
+	wantSyns := []Token{ID, pragma, ID, ID, ILLEGAL, endPragma, ID, pragma, ID, SHARP}
+	checkTokens(t, toks, syns, wantToks, wantSyns)
+	if s.Condition() != "pragma" {
+		t.Errorf("got condition %s, expected pragma", s.Condition())
+	}
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Code != ErrIllegalChar {
+		t.Errorf("got errors %v, expected an illegal char", errs)
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	s := NewScanner(NewInput("a b c d"))
+	emit := func(take bool, action func(s *Scanner) error) func(s *Scanner) error {
+		return func(s *Scanner) error {
+			if take {
+				s.Take()
+			}
+			s.Emit(ID, nil)
+			return action(s)
+		}
+	}
+	s.DefineCondition(Initial, Condition{Rules: append([]Rule{
+		{Start: peekIs('a'), Read: emit(true, func(s *Scanner) error { return errors.New("bad a") })},
+		{Start: peekIs('b'), Read: emit(false, func(s *Scanner) error { return nil })},
+		{Start: peekIs('c'), Read: emit(true, func(s *Scanner) error { s.PopCondition(); return nil })},
+		{Start: peekIs('d'), Read: emit(true, func(s *Scanner) error { s.SwitchCondition("none"); return nil })},
+	}, DefaultRules()...)})
+
+	_, syns := scanAll(s)
+	wantSyns := []Token{ID, ILLEGAL, ID, ID, SHARP}
+	checkTokens(t, nil, syns, nil, wantSyns)
+	errs := s.Errors()
+	wantCodes := []ErrorCode{ErrRule, ErrRule, ErrCondition, ErrCondition}
+	wantCols := []int{1, 3, 6, 8}
+	if len(errs) != len(wantCodes) {
+		t.Fatalf("got errors %v, expected codes %v", errs, wantCodes)
+	}
+	for i, err := range errs {
+		if err.Code != wantCodes[i] || err.Pos.Col != wantCols[i] {
+			t.Errorf("error %d: got %v %v, expected %v at col %d", i, err.Code, err, wantCodes[i], wantCols[i])
+		}
+	}
+	if errs[0].Msg != "bad a" || s.Condition() != Initial {
+		t.Errorf("got error %v in condition %s", errs[0], s.Condition())
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	fset := NewFileSet()
+	a := fset.AddFile("a.lab", "begin x := 1;\n  变量 := 2\n")
+	b := fset.AddFile("b.lab", "if y\n\n then ? end")
+	src := "x :=\n  y;\n 变量 ?"
+	c := fset.AddReaderFile("c.lab", len(src))
+	want := map[*File]string{
+		a: "<'变量', id> a.lab:2:3",
+		b: "<'?', illegal> b.lab:3:7",
+		c: "<'?', illegal> c.lab:3:5",
+	}
+	for _, f := range []*File{a, b, c} {
+		input := f.NewInput()
+		if f == c {
+			input = f.NewReaderInput(iotest.OneByteReader(strings.NewReader(src)))
+		}
+		s := NewScanner(input)
+		found := false
+		for {
+			lex := s.Scan()
+			if lex.Start.Filename != f.Name() || lex.End.Filename != f.Name() {
+				t.Errorf("%v: got files %q and %q, expected %s", lex, lex.Start.Filename, lex.End.Filename, f.Name())
+			}
+			found = found || lex.String() == want[f]
+			if s.EOF() {
+				break
+			}
+		}
+		if !found {
+			t.Errorf("no %s in %s", want[f], f.Name())
+		}
+		if f != a {
+			if errs := s.Errors(); len(errs) != 1 || errs[0].Pos.Filename != f.Name() {
+				t.Errorf("got errors %v, expected one in %s", errs, f.Name())
+			}
+		}
+	}
+	if files := fset.Files(); len(files) != 3 || files[2] != c || c.Size() != len(src) {
+		t.Errorf("got files %v", files)
+	}
+}
+
+func TestPreprocessor(t *testing.T) {
+	files := map[string]string{
+		"main.lab": "begin {$include 'decl.lab'} x := 1;\n" +
+			"{$ifdef DEBUG} trace {$else} {$ifndef FAST} slow {$endif} fast {$endif}\n" +
+			"{$INCLUDE loop.lab} end",
+		"decl.lab": "{$define fast} var\n  y",
+		"loop.lab": "{$include 'main.lab'} z ?",
+	}
+	fset := NewFileSet()
+	p := NewPreprocessor(fset, fset.AddFile("main.lab", files["main.lab"]), nil)
+	p.ReadFile = func(name string) ([]byte, error) {
+		if src, ok := files[name]; ok {
+			return []byte(src), nil
+		}
+		return nil, errors.New("no file " + name)
+	}
+	want := []string{"main.lab:1:1 begin", "decl.lab:1:16 var", "decl.lab:2:3 y", "main.lab:1:29 x", "main.lab:1:31 :=",
+		"main.lab:1:34 1", "main.lab:1:35 ;", "main.lab:2:59 fast", "loop.lab:1:23 z", "loop.lab:1:25 ?",
+		"main.lab:3:21 end", "main.lab:3:24 #"}
+	var got []string
+	for {
+		lex := p.Scan()
+		got = append(got, lex.Start.String()+" "+lex.Lit)
+		if p.EOF() {
+			break
+		}
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got %v, expected %v", got, want)
+	}
+	errs := p.Errors()
+	if len(errs) != 2 || errs[0].Code != ErrIncludeCycle || errs[1].Code != ErrIllegalChar {
+		t.Errorf("got errors %v, expected an include cycle and an illegal char", errs)
+	} else if msg := errs[0].Error(); msg != "loop.lab:1:1: include cycle main.lab -> loop.lab -> main.lab" {
+		t.Errorf("got %s", msg)
+	}
+
+	fset = NewFileSet()
+	p = NewPreprocessor(fset, fset.AddFile("bad.lab", "{$endif} {$ifdef 1} {$endif} {$foo} {$include 'none'} a {$ifdef X} b"), nil)
+	for !p.EOF() {
+		p.Next()
+	}
+	var codes []ErrorCode
+	for _, err := range p.Errors() {
+		codes = append(codes, err.Code)
+	}
+	if len(codes) != 5 || codes[0] != ErrDirective || codes[1] != ErrDirective || codes[2] != ErrDirective ||
+		codes[3] != ErrInclude || codes[4] != ErrDirective {
+		t.Errorf("got errors %v", codes)
+	}
+	// the skipped text is silent, and the absolute name of a file including itself is a cycle
+	abs, err := filepath.Abs("self.lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset = NewFileSet()
+	p = NewPreprocessor(fset, fset.AddFile("self.lab", "{$ifdef X} ?? {$endif} {$include '"+abs+"'} a"), nil)
+	for !p.EOF() {
+		p.Next()
+	}
+	if errs := p.Errors(); len(errs) != 1 || errs[0].Code != ErrIncludeCycle {
+		t.Errorf("got errors %v, expected an include cycle", errs)
+	}
+}
+
+func TestLexParallel(t *testing.T) {
+	defer func(n int) { minChunk = n }(minChunk)
+	minChunk = 1
+	lines := []string{
+		"begin x := 9; if x >= 1.5e3 then y := 'a b' end",
+		"{ a comment",
+		"  over lines (* nested *)",
+		"} z := 'it''s' 0099 ??",
+		"// a line comment",
+		"while $FF <> x do x := x - 1 'string",
+		"(* another",
+		"",
+		"   comment *) end",
+	}
+	program := strings.Repeat(strings.Join(lines, "\n")+"\n", 5)
+	indented := strings.Repeat("while x do\n  y := (1 +\n2)\n  if y then\n    z := 1\nw := 2\n", 5)
+	// the first chunk has no tokens of its own
+	comment := "{" + strings.Repeat("a\n", 70000) + "} x"
+	for _, mode := range []Mode{0, Layout} {
+		for _, p := range []string{program, program + "{ unterminated\n x y\n", "a\nb # c\nd\ne\n", indented, comment} {
+			s := NewScanner(NewInput(p))
+			s.SetMode(mode)
+			var want []Lexeme
+			for {
+				want = append(want, s.Scan())
+				if s.EOF() {
+					break
+				}
+			}
+			for workers := 1; workers <= 9; workers += 4 {
+				tokens, errs := LexParallel(p, nil, mode, workers)
+				if len(tokens) != len(want) {
+					t.Fatalf("mode %d, %d workers: got %d tokens, expected %d", mode, workers, len(tokens), len(want))
+				}
+				for i := range want {
+					if tokens[i] != want[i] {
+						t.Errorf("mode %d, %d workers: token %d got %v, expected %v", mode, workers, i, tokens[i], want[i])
+					}
+				}
+				if len(errs) != len(s.Errors()) {
+					t.Fatalf("mode %d, %d workers: got errors %v, expected %v", mode, workers, errs, s.Errors())
+				}
+				for i, err := range s.Errors() {
+					if *errs[i] != *err {
+						t.Errorf("mode %d, %d workers: error %d got %v, expected %v", mode, workers, i, errs[i], err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	st := NewStream(NewScanner(NewInput("a b c d e")))
+	if lex := st.PeekN(3); lex.Lit != "c" {
+		t.Errorf("PeekN(3) got %v, expected c", lex)
+	}
+	if tok, _ := st.Next(); tok != "a" {
+		t.Errorf("Next got %s, expected a", tok)
+	}
+
+	outer := st.Mark()
+	st.Next()
+	inner := st.Mark()
+	st.Next()
+	st.Next()
+	st.Reset(inner)
+	if tok, _ := st.Peek(); tok != "b" {
+		t.Errorf("Peek after inner Reset got %s, expected b", tok)
+	}
+	if tok, _ := st.Next(); tok != "c" {
+		t.Errorf("Next after inner Reset got %s, expected c", tok)
+	}
+	st.Reset(outer)
+	if tok, _ := st.Next(); tok != "b" {
+		t.Errorf("Next after outer Reset got %s, expected b", tok)
+	}
+	if len(st.buf) != 2 {
+		t.Errorf("got %d buffered tokens without marks, expected 2 of lookahead", len(st.buf))
+	}
+
+	// releasing a mark twice doesn't release another one
+	first := st.Mark()
+	second := st.Mark()
+	st.Release(first)
+	st.Release(first)
+	st.Next()
+	st.Next()
+	st.Reset(second)
+	if tok, _ := st.Next(); tok != "c" {
+		t.Errorf("Next after Reset got %s, expected c", tok)
+	}
+
+	for !st.EOF() {
+		st.Next()
+	}
+	if lex := st.PeekN(2); lex.Tok != SHARP {
+		t.Errorf("PeekN after EOF got %v, expected #", lex)
+	}
+
+	// a stream over another token source
+	program := "x {$ifdef A} y {$endif} ? z"
+	fset := NewFileSet()
+	want, _ := scanAll(NewPreprocessor(fset, fset.AddFile("a.lab", program), nil))
+	var src TokenSource = NewPreprocessor(fset, fset.AddFile("a.lab", program), nil)
+	st = NewStream(src)
+	if lex := st.PeekN(2); lex.Lit != "?" || len(st.Errors()) != 1 {
+		t.Errorf("PeekN(2) got %v with errors %v, expected ? with one error", lex, st.Errors())
+	}
+	if toks, _ := scanAll(st); strings.Join(toks, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, expected %q", toks, want)
+	}
+}
+
+// testRelex checks that relexing the edit of program gives the tokens of the edited program
+func testRelex(t *testing.T, program string, e Edit, mode Mode) {
+	t.Helper()
+	old := lexAll(program, nil, mode)
+	edited := program[:e.Start] + e.Text + program[e.End:]
+	tokens, change := Relex(edited, old, e, nil, mode)
+	want := lexAll(edited, nil, mode)
+	if len(tokens) != len(want) {
+		t.Errorf("edit %+v of %q: got %v, expected %v", e, program, tokens, want)
+		return
+	}
+	for i := range want {
+		if tokens[i] != want[i] {
+			t.Errorf("edit %+v of %q: token %d got %+v, expected %+v", e, program, i, tokens[i], want[i])
+		}
+	}
+	if change.To-change.From != len(want)-len(old)+change.OldTo-change.From {
+		t.Errorf("edit %+v of %q: inconsistent change %+v", e, program, change)
+	}
+}
+
+func TestRelex(t *testing.T) {
+	program := "begin x := 9; { note }\n  if x > 9 then y := 'a b';\nwhile x <> 0 do x := x - 1 end"
+	edits := []Edit{
+		{6, 7, "abc"},        // rename x
+		{11, 12, "1.5"},      // the number becomes a real
+		{14, 14, "(* c *) "}, // insert a comment
+		{16, 16, "}"},        // close the comment early
+		{34, 35, "\n\n  "},   // add lines
+		{48, 48, "'"},        // break the string
+		{len(program), len(program), " z"},
+		{0, len(program), ""}, // delete all
+	}
+	for _, e := range edits {
+		testRelex(t, program, e, 0)
+	}
+	// edits in the whitespace and comments before the first token
+	testRelex(t, "  x := 1", Edit{0, 0, "y"}, 0)
+	testRelex(t, "{ note } x", Edit{0, 0, "a "}, 0)
+	testRelex(t, "\n\nbegin end", Edit{0, 1, "{ c }"}, 0)
+	testRelex(t, "x", Edit{0, 0, "{ "}, 0)
+
+	// the layout tokens after an edit depend on the lines before it
+	layout := "while x do\n  y := 1\n  if y then\n    z := 1\nw := 2"
+	for _, e := range []Edit{
+		{19, 19, "\n    v := 0"}, // indent a new line deeper
+		{20, 22, ""},             // dedent if
+		{17, 17, "(1 +\n"},       // join lines in parentheses
+		{0, 0, "  "},             // indent the first line
+	} {
+		testRelex(t, layout, e, Layout)
+	}
+
+	// a local edit only relexes a few tokens
+	old := lexAll(program, nil, 0)
+	_, change := Relex(program[:6]+"y"+program[7:], old, Edit{6, 7, "y"}, nil, 0)
+	if change != (Change{0, 2, 2}) {
+		t.Errorf("got change %+v, expected {0 2 2}", change)
+	}
+}
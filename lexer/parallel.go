@@ -0,0 +1,179 @@
+package lexer
+
+import (
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minChunk is the least size of the chunks lexed in parallel
+var minChunk = 1 << 16
+
+// chunk is a part of the program lexed by a worker,
+// it starts right after a '\n' which is a safe point unless it's in a comment or string
+type chunk struct {
+	start, end int
+	scanner    *Scanner
+	// tokens start in the chunk, next is the first token after it
+	tokens []Lexeme
+	next   Lexeme
+}
+
+// lex scans the tokens of the chunk and the first token after it
+func (c *chunk) lex(last bool) {
+	for {
+		lex := c.scanner.Scan()
+		if lex.Start.Offset >= c.end && !last {
+			c.next = lex
+			return
+		}
+		c.tokens = append(c.tokens, lex)
+		if c.scanner.EOF() {
+			return
+		}
+	}
+}
+
+// find returns the index of the token lex in the chunk
+func (c *chunk) find(lex Lexeme) (int, bool) {
+	i := sort.Search(len(c.tokens), func(i int) bool {
+		return c.tokens[i].Start.Offset >= lex.Start.Offset
+	})
+	if i < len(c.tokens) && c.tokens[i].Start == lex.Start && c.tokens[i].End == lex.End &&
+		c.tokens[i].Tok == lex.Tok && c.tokens[i].Lit == lex.Lit {
+		return i, true
+	}
+	return 0, false
+}
+
+// LexParallel scans all tokens of program until '#' as a Scanner of spec in mode does,
+// the program is split after some '\n' into chunks which are lexed by workers goroutines,
+// and the token streams are stitched at the first token both chunks agree on,
+// so a split in a comment or string is resynchronized by lexing on.
+// It returns the same tokens and errors as scanning the program sequentially.
+// In Layout mode the program is lexed by one worker, see Layout
+func LexParallel(program string, spec *LexerSpec, mode Mode, workers int) ([]Lexeme, ErrorList) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if mode&Layout != 0 {
+		workers = 1
+	}
+	program = strings.TrimSuffix(program, "#")
+	chunks := split(program, workers)
+
+	// all inputs share the buffer of the program
+	buf := []byte(program)
+	row := 1
+	for i, c := range chunks {
+		if i > 0 {
+			row += strings.Count(program[chunks[i-1].start:c.start], "\n")
+		}
+		input := &Input{position: c.start, row: row, col: 1, buf: buf, src: program, err: io.EOF}
+		c.scanner = NewSpecScanner(input, spec)
+		c.scanner.SetMode(mode)
+	}
+	var wg sync.WaitGroup
+	jobs := make(chan int, len(chunks))
+	for i := range chunks {
+		jobs <- i
+	}
+	close(jobs)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				chunks[i].lex(i == len(chunks)-1)
+			}
+		}()
+	}
+	wg.Wait()
+	return stitch(chunks)
+}
+
+// split splits program into chunks for workers, each one but the first starts after a '\n'
+func split(program string, workers int) []*chunk {
+	n := workers
+	if max := len(program) / minChunk; n > max {
+		n = max
+	}
+	chunks := []*chunk{{start: 0}}
+	for k := 1; k < n; k++ {
+		b := k * len(program) / n
+		if b <= chunks[len(chunks)-1].start {
+			continue
+		}
+		i := strings.IndexByte(program[b:], '\n')
+		if i < 0 || b+i+1 >= len(program) {
+			break
+		}
+		if b += i + 1; b > chunks[len(chunks)-1].start {
+			chunks = append(chunks, &chunk{start: b})
+		}
+	}
+	for i, c := range chunks {
+		c.end = len(program)
+		if i+1 < len(chunks) {
+			c.end = chunks[i+1].start
+		}
+	}
+	return chunks
+}
+
+// stitch joins the tokens of chunks, the scanner of a chunk lexes on
+// until its token is one of a later chunk, then the tokens of that chunk are taken
+func stitch(chunks []*chunk) ([]Lexeme, ErrorList) {
+	// segment is the part of the tokens from offset from taken from chunk c
+	type segment struct {
+		c    *chunk
+		from int
+	}
+	cur := chunks[0]
+	tokens := cur.tokens
+	if len(chunks) > 1 {
+		n := 1
+		for _, c := range chunks {
+			n += len(c.tokens)
+		}
+		tokens = append(make([]Lexeme, 0, n), tokens...)
+	}
+	segments := []segment{{cur, 0}}
+	pend := cur.next
+	for _, c := range chunks[1:] {
+		if len(tokens) > 0 && tokens[len(tokens)-1].Tok == SHARP {
+			break
+		}
+		for pend.Start.Offset < c.end {
+			if i, ok := c.find(pend); ok {
+				tokens = append(tokens, c.tokens[i:]...)
+				segments = append(segments, segment{c, pend.Start.Offset})
+				cur, pend = c, c.next
+				break
+			}
+			// the chunk started in a comment or string, lex on
+			tokens = append(tokens, pend)
+			if cur.scanner.EOF() {
+				break
+			}
+			pend = cur.scanner.Scan()
+		}
+	}
+	// the last chunk may be passed over too
+	for len(tokens) == 0 || tokens[len(tokens)-1].Tok != SHARP {
+		tokens = append(tokens, pend)
+		pend = cur.scanner.Scan()
+	}
+
+	var errors ErrorList
+	for i, seg := range segments {
+		for _, err := range seg.c.scanner.Errors() {
+			if err.Pos.Offset >= seg.from && (i+1 == len(segments) || err.Pos.Offset < segments[i+1].from) {
+				errors = append(errors, err)
+			}
+		}
+	}
+	return tokens, errors
+}
@@ -0,0 +1,112 @@
+package lexer
+
+// Edit replaces the bytes [Start, End) of a program with Text
+type Edit struct {
+	Start, End int
+	Text       string
+}
+
+// Change is the result of relexing,
+// the old tokens [From, OldTo) are replaced by the new tokens [From, To)
+type Change struct {
+	From, OldTo, To int
+}
+
+// newInputAt returns the input of program which starts at pos
+func newInputAt(program string, pos Position) *Input {
+	input := NewInput(program)
+	input.position, input.row, input.col = pos.Offset, pos.Row, pos.Col
+	return input
+}
+
+// lexAll scans all tokens of program until '#'
+func lexAll(program string, spec *LexerSpec, mode Mode) []Lexeme {
+	s := NewSpecScanner(NewInput(program), spec)
+	s.SetMode(mode)
+	var tokens []Lexeme
+	for {
+		tokens = append(tokens, s.Scan())
+		if s.EOF() {
+			return tokens
+		}
+	}
+}
+
+// Relex re-tokenizes program which is the result of edit to the program of the old tokens,
+// the old tokens end with '#' as those scanned by a Scanner of spec in mode,
+// a nil spec is the begin/if/while language.
+// It relexes from the token before the edit, since the scanner may look one token ahead,
+// or from the start of the program if there isn't one,
+// until a new token lines up with an old one after the edit again,
+// then the rest old tokens are moved to their new positions.
+// In Layout mode the whole program is relexed, see Layout
+func Relex(program string, old []Lexeme, edit Edit, spec *LexerSpec, mode Mode) ([]Lexeme, Change) {
+	if len(old) == 0 || mode&Layout != 0 {
+		tokens := lexAll(program, spec, mode)
+		return tokens, Change{0, len(old), len(tokens)}
+	}
+
+	// the restart point is the start of the token before the first one touching the edit
+	from := 0
+	for from < len(old)-1 && old[from].End.Offset < edit.Start {
+		from++
+	}
+	if from > 0 {
+		from--
+	}
+	// the edit may be in the whitespace or comments before the first token
+	start := old[from].Start
+	if from == 0 {
+		start = Position{Offset: 0, Row: 1, Col: 1}
+	}
+
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	editEnd := edit.Start + len(edit.Text)
+	s := NewSpecScanner(newInputAt(program, start), spec)
+	s.SetMode(mode)
+	var tokens []Lexeme
+	j := from
+	for {
+		lex := s.Scan()
+		if lex.Start.Offset >= editEnd {
+			// try to line up with the old tokens after the edit
+			for j < len(old) && (old[j].Start.Offset < edit.End || old[j].Start.Offset+delta < lex.Start.Offset) {
+				j++
+			}
+			if j < len(old) && old[j].Start.Offset+delta == lex.Start.Offset &&
+				old[j].Tok == lex.Tok && old[j].Lit == lex.Lit {
+				break
+			}
+		}
+		tokens = append(tokens, lex)
+		if s.EOF() {
+			j = len(old)
+			break
+		}
+	}
+
+	result := make([]Lexeme, 0, from+len(tokens)+len(old)-j)
+	result = append(result, old[:from]...)
+	result = append(result, tokens...)
+	if j < len(old) {
+		// the tokens after the lined up one move together with it
+		sync := old[j]
+		now := s.Lexeme()
+		for _, lex := range old[j:] {
+			lex.Start = movePos(lex.Start, sync.Start, now.Start)
+			lex.End = movePos(lex.End, sync.Start, now.Start)
+			result = append(result, lex)
+		}
+	}
+	return result, Change{from, j, from + len(tokens)}
+}
+
+// movePos moves pos as the old position moves to now
+func movePos(pos, old, now Position) Position {
+	if pos.Row == old.Row {
+		pos.Col += now.Col - old.Col
+	}
+	pos.Row += now.Row - old.Row
+	pos.Offset += now.Offset - old.Offset
+	return pos
+}
@@ -1,7 +1,26 @@
 package lexer
 
 import (
-	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mode controls the scanner behavior
+type Mode uint
+
+const (
+	// ScanComments returns comments as COMMENT tokens instead of skipping them
+	ScanComments Mode = 1 << iota
+	// BackslashEscapes decodes escapes like \n and \x41 in strings
+	BackslashEscapes
+	// IgnoreCase matches keywords case-insensitively, so BEGIN and Begin are begin
+	IgnoreCase
+	// FoldIdents folds identifiers to lower case as their Value, the Lit keeps the spelling
+	FoldIdents
+	// Layout returns NEWLINE, INDENT and DEDENT tokens for the line structure,
+	// the layout tokens of a line depend on all lines before it,
+	// so Relex and LexParallel can't start in the middle of a program in this mode
+	Layout
 )
 
 // Scanner stores token
@@ -9,14 +28,87 @@ type Scanner struct {
 	input *Input
 	token string
 	syn   Token
+	val   interface{}
+	mode  Mode
+	spec  *LexerSpec
+	// start and end position of current token
+	start, end Position
+	// lit buffers the raw chars of current token
+	lit []byte
+	// runes buffers the chars of a string literal with quotes or escapes
+	runes []rune
+	// names interns the identifiers, folds caches their lower case
+	names map[string]string
+	folds map[string]string
+
+	// error reporting
+	err    ErrorHandler
+	errors ErrorList
+	// ErrorCount is the number of errors encountered
+	ErrorCount int
+
+	// start conditions, the name of current one is empty for Initial
+	conds     map[string]*Condition
+	cond      *Condition
+	condName  string
+	condStack []string
+
+	layout layout
 }
 
-// NewScanner creates a scanner to scan token
+// NewScanner creates a scanner to scan token of the begin/if/while language
 func NewScanner(input *Input) *Scanner {
+	return NewSpecScanner(input, defaultSpec)
+}
+
+// NewSpecScanner creates a scanner to scan token of the language given by spec,
+// a nil spec is the begin/if/while language
+func NewSpecScanner(input *Input, spec *LexerSpec) *Scanner {
+	if spec == nil {
+		spec = defaultSpec
+	}
 	return &Scanner{
 		input: input,
 		token: "",
+		spec:  spec,
+		cond:  initial,
+	}
+}
+
+// SetMode sets the mode which controls the scanner behavior
+func (s *Scanner) SetMode(mode Mode) {
+	s.mode = mode
+}
+
+// Spec returns the spec of the language scanned
+func (s *Scanner) Spec() *LexerSpec {
+	return s.spec
+}
+
+// SetErrorHandler sets a handler which is called for each lexical error
+func (s *Scanner) SetErrorHandler(err ErrorHandler) {
+	s.err = err
+}
+
+// Errors returns all lexical errors accumulated so far
+func (s *Scanner) Errors() ErrorList {
+	return s.errors
+}
+
+// error records a lexical error and reports it to the error handler
+func (s *Scanner) error(pos Position, code ErrorCode, msg string) {
+	if s.err != nil {
+		s.err(pos, code, msg)
 	}
+	s.errors.Add(pos, code, msg)
+	s.ErrorCount++
+}
+
+// collapse records the skipped text lit as an ILLEGAL token
+// and returns a lexical error at the start of it
+func (s *Scanner) collapse(code ErrorCode, lit, msg string) error {
+	s.setLex(lit, ILLEGAL)
+	return &Error{Pos: s.start, Code: code, Msg: msg}
 }
 
 // SkipWhitespace will skip whitespace
@@ -43,170 +135,495 @@ func (s *Scanner) Next() (string, Token) {
 	return s.Peek()
 }
 
+// Lexeme returns current token value with its position
+func (s *Scanner) Lexeme() Lexeme {
+	return Lexeme{
+		Tok:   s.syn,
+		Lit:   s.token,
+		Start: s.start,
+		End:   s.end,
+		Value: s.val,
+	}
+}
+
+// Scan reads the next token and returns its value with position
+func (s *Scanner) Scan() Lexeme {
+	s.read()
+	return s.Lexeme()
+}
+
 // setLex records current token info
 func (s *Scanner) setLex(token string, syn Token) {
 	s.token = token
 	s.syn = syn
+	s.val = nil
+}
+
+// take appends current char to lit and returns the next char
+func (s *Scanner) take() rune {
+	s.lit = append(s.lit, s.input.raw()...)
+	ch, _ := s.input.Next()
+	return ch
 }
 
-// read chars until gets a total token
+// text returns the raw text of current token,
+// it is sliced out of the program without copying when the program is in memory
+func (s *Scanner) text() string {
+	if str, ok := s.input.slice(s.start.Offset); ok {
+		return str
+	}
+	return string(s.lit)
+}
+
+// intern returns the text of current token, the same identifiers share one string
+func (s *Scanner) intern() string {
+	if str, ok := s.names[string(s.lit)]; ok {
+		return str
+	}
+	if s.names == nil {
+		s.names = make(map[string]string)
+	}
+	str := s.text()
+	s.names[str] = str
+	return str
+}
+
+// read chars until gets a total token,
+// the bad text is returned as an ILLEGAL token so that parsers can recover from it
 func (s *Scanner) read() {
-	var err error
-	// fmt.Println("==========", string(s.input.Peek()))
-	s.SkipWhitespace()
-	if ch := s.input.Peek(); ch == '#' {
-		s.setLex("#", SHARP)
-		s.input.Next()
-	} else if IsDigit(ch) {
-		err = s.readNum()
-	} else if IsLetter(ch) {
-		err = s.readID()
-	} else if IsOpChar(ch) {
-		err = s.readOp()
-	} else {
-		// fmt.Println("==========", string(s.input.Peek()))
-		fmt.Println("read 不合法的字符串" + string(ch))
-		s.input.Next()
-		s.read()
+	if s.mode&Layout != 0 {
+		s.readLayout()
 		return
 	}
-	if err != nil {
-		// fmt.Println("234242424242", string(s.input.Peek()))
-		fmt.Println(err)
-		s.read()
+	for {
+		if !s.cond.KeepSpace {
+			s.SkipWhitespace()
+		}
+		s.start = s.input.Pos()
+		s.report(s.readToken())
+		if s.syn != COMMENT || s.mode&ScanComments != 0 {
+			break
+		}
+	}
+	s.end = s.input.Pos()
+}
+
+// readToken reads a token by the first rule of current start condition which applies,
+// a char no rule applies to is an ILLEGAL token
+func (s *Scanner) readToken() error {
+	s.lit = s.lit[:0]
+	if s.input.EOF() {
+		return s.readSharp()
+	}
+	for _, rule := range s.cond.Rules {
+		if rule.Start(s) {
+			start := s.input.position
+			err := rule.Read(s)
+			if s.input.position == start && !s.input.EOF() {
+				// the token would be read again and again, skip a char instead
+				s.report(err)
+				return s.skipChar(ErrRule, "rule reads no chars at")
+			}
+			return err
+		}
+	}
+	return s.skipChar(ErrIllegalChar, "illegal char")
+}
+
+// skipChar records current char as an ILLEGAL token and returns the lexical error msg of it
+func (s *Scanner) skipChar(code ErrorCode, msg string) error {
+	str := string(s.input.raw())
+	s.input.Next()
+	return s.collapse(code, str, msg+" "+strconv.Quote(str))
+}
+
+// report records err of reading a token as a lexical error,
+// an error of a Rule which isn't an *Error is at the start of the token
+func (s *Scanner) report(err error) {
+	switch err := err.(type) {
+	case nil:
+	case *Error:
+		s.error(err.Pos, err.Code, err.Msg)
+	default:
+		s.error(s.start, ErrRule, err.Error())
+	}
+}
+
+// commentAhead returns true if a comment starts at current char
+func (s *Scanner) commentAhead() bool {
+	switch s.input.Peek() {
+	case '{':
+		return true
+	case '(':
+		ch, _ := s.input.Next()
+		s.input.Back()
+		return ch == '*'
+	case '/':
+		ch, _ := s.input.Next()
+		s.input.Back()
+		return ch == '/'
+	}
+	return false
+}
+
+// readComment read the comment, { ... } and (* ... *) may be nested
+func (s *Scanner) readComment() error {
+	// line comment // ...
+	if ch := s.input.Peek(); ch == '/' {
+		for !s.input.EOF() && ch != '\n' {
+			ch = s.take()
+		}
+		s.setLex(s.text(), COMMENT)
+		return nil
+	}
+
+	// the stack of closing delimiters '}' or ')' for "*)"
+	var closers []rune
+	for {
+		if s.input.EOF() {
+			s.setLex(s.text(), COMMENT)
+			return &Error{Pos: s.start, Code: ErrUnterminatedComment, Msg: "comment not terminated"}
+		}
+		var top rune
+		if len(closers) > 0 {
+			top = closers[len(closers)-1]
+		}
+		switch ch := s.input.Peek(); {
+		case ch == '{':
+			s.take()
+			closers = append(closers, '}')
+		case ch == '(':
+			if s.take() == '*' {
+				s.take()
+				closers = append(closers, ')')
+			}
+		case ch == '}' && top == '}':
+			s.take()
+			closers = closers[:len(closers)-1]
+		case ch == '*':
+			if s.take() == ')' && top == ')' {
+				s.take()
+				closers = closers[:len(closers)-1]
+			}
+		default:
+			s.take()
+		}
+		if len(closers) == 0 {
+			s.setLex(s.text(), COMMENT)
+			return nil
+		}
+	}
+}
+
+// readIllegal skips the chars until one may start a token or whitespace,
+// a run of invalid UTF-8 is skipped as another ILLEGAL token
+func (s *Scanner) readIllegal() error {
+	code, msg := ErrIllegalChar, "illegal chars "
+	invalid := s.input.Invalid()
+	if invalid {
+		code, msg = ErrInvalidUTF8, "invalid UTF-8 encoding "
 	}
+	for ch := s.input.Peek(); !s.isStartOrSpace(ch) && s.input.Invalid() == invalid; {
+		ch = s.take()
+	}
+	str := s.text()
+	return s.collapse(code, str, msg+strconv.Quote(str))
+}
+
+// isStartOrSpace returns true if ch may start a token or is whitespace
+func (s *Scanner) isStartOrSpace(ch rune) bool {
+	return ch == '#' || ch == '{' || ch == '$' || ch == '\'' || IsWhitespace(ch) ||
+		IsDigit(ch) || IsLetter(ch) || s.spec.IsOpStart(ch)
 }
 
-// readNum read the num type
+// readNum read the numbers, they are decimal integers and reals,
+// or hex integers like $FF and 0x1F
 func (s *Scanner) readNum() error {
-	// first digit [1-9]
 	ch := s.input.Peek()
-	str := string(ch)
+	if ch == '$' {
+		s.take()
+		return s.readHex()
+	}
 
 	if ch == '0' {
-		// if ch == '0'但下一个字符为字母则跳过并且报错
-		if ch, _ := s.input.Next(); IsLetter(ch) || IsDigit(ch) {
-			for ch := s.input.Peek(); IsLetter(ch) || IsDigit(ch); {
-				str += string(ch)
-				ch, _ = s.input.Next()
+		ch = s.take()
+		if ch == 'x' || ch == 'X' {
+			s.take()
+			return s.readHex()
+		}
+		// if ch == '0'但下一个字符为数字则跳过并且报错
+		if IsDigit(ch) {
+			code := ErrLeadingZero
+			for ; IsLetterOrDigit(ch); ch = s.take() {
+				if IsLetter(ch) {
+					code = ErrNumLetter
+				}
 			}
-			return s.input.Collapse("readNum 不合法的字符串:" + str)
+			str := s.text()
+			return s.collapse(code, str, "illegal number "+str)
 		}
-
-		s.setLex(str, NUM)
 	} else {
-		// digit [0-9]
 		// 一直读完数字
-		for {
-			ch, _ = s.input.Next()
-			if IsDigit(ch) {
-				str += string(ch)
-			} else {
-				break
-			}
+		for IsDigit(ch) {
+			ch = s.take()
 		}
-		// 数字后面紧接着字母则报错并且移动到第一个运算符号或空白符
-		if IsLetter(ch) {
-			for IsLetter(ch) || IsDigit(ch) {
-				str += string(ch)
-				ch, _ = s.input.Next()
-				// fmt.Println("343434", str)
+	}
+
+	isReal := false
+	// fraction, '.' must be followed by a digit so that 1..9 isn't a real
+	if ch == '.' {
+		ch, _ = s.input.Next()
+		s.input.Back()
+		if IsDigit(ch) {
+			isReal = true
+			for ch = s.take(); IsDigit(ch); {
+				ch = s.take()
 			}
-			// fmt.Println("2323223", string(s.input.Peek()))
-			return s.input.Collapse("readNum 不合法的字符串:" + str)
+		} else {
+			ch = '.'
+		}
+	}
+	// exponent
+	if ch == 'e' || ch == 'E' {
+		isReal = true
+		ch = s.take()
+		if ch == '+' || ch == '-' {
+			ch = s.take()
+		}
+		if !IsDigit(ch) {
+			s.skipLetterOrDigit()
+			str := s.text()
+			return s.collapse(ErrExponent, str, "malformed exponent "+str)
 		}
-		s.setLex(str, NUM)
+		for IsDigit(ch) {
+			ch = s.take()
+		}
+	}
+	// 数字后面紧接着字母则报错并且移动到第一个运算符号或空白符
+	if IsLetterOrDigit(ch) {
+		s.skipLetterOrDigit()
+		str := s.text()
+		return s.collapse(ErrNumLetter, str, "illegal number "+str)
 	}
+
+	str := s.text()
+	if isReal {
+		val, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return s.collapse(ErrOverflow, str, "real overflow "+str)
+		}
+		s.setLex(str, REALNUM)
+		s.val = val
+		return nil
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return s.collapse(ErrOverflow, str, "integer overflow "+str)
+	}
+	s.setLex(str, INTNUM)
+	s.val = val
 	return nil
 }
 
-// readID read the identifier and keywords
-func (s *Scanner) readID() error {
-	// first letter [A-Za-z]
+// readHex read the hex digits after the prefix $ or 0x
+func (s *Scanner) readHex() error {
+	prefix := len(s.lit)
 	ch := s.input.Peek()
-	str := string(ch)
-	// letter [A-Za-z0-9]
-	for {
-		ch, _ = s.input.Next()
-		if IsLetter(ch) || IsDigit(ch) {
-			str += string(ch)
-		} else {
-			// fmt.Println("ID:"+str, string(ch))
-			break
-		}
+	for IsHexDigit(ch) {
+		ch = s.take()
 	}
-	// recognize keywords
-	if kw, ok := keywords[str]; ok {
-		s.setLex(str, kw)
-	} else {
-		s.setLex(str, ID)
+	if IsLetterOrDigit(ch) {
+		s.skipLetterOrDigit()
+		str := s.text()
+		return s.collapse(ErrNumLetter, str, "illegal hex number "+str)
 	}
+	str := s.text()
+	digits := str[prefix:]
+	if digits == "" {
+		return s.collapse(ErrHexDigits, str, "hex number without digits "+str)
+	}
+	val, err := strconv.ParseInt(digits, 16, 64)
+	if err != nil {
+		return s.collapse(ErrOverflow, str, "integer overflow "+str)
+	}
+	s.setLex(str, INTNUM)
+	s.val = val
 	return nil
 }
 
-// readOp read the operations
-func (s *Scanner) readOp() error {
-	// operator: :  :=  +  -  *  /  <  <=  <>  >  >=  =  ;  (  )  #
-	var str string
-	// fmt.Println("2323223", string(s.input.Peek()))
-	switch ch := s.input.Peek(); ch {
-	case '=', '+', '-', '*', '/', ';', '(', ')', '#':
-		str += string(ch)
-		s.setLex(str, keywords[str])
-		s.input.Next()
-		return nil
-	case ':', '<', '>':
-		str += string(ch)
-
-		// switch
-		switch ch, _ := s.input.Next(); ch {
-		case '=', '>':
-			str += string(ch)
-			if _, ok := keywords[str]; ok {
-				s.setLex(str, keywords[str])
-				s.input.Next()
+// skipLetterOrDigit skips the rest letters and digits of a bad number
+func (s *Scanner) skipLetterOrDigit() {
+	for IsLetterOrDigit(s.input.Peek()) {
+		s.take()
+	}
+}
+
+// readString read the string or char literal, a quote inside is written twice
+// and backslash escapes are decoded in BackslashEscapes mode
+func (s *Scanner) readString() error {
+	val := s.runes[:0]
+	// bad is true after an unknown escape, cooked after a doubled quote or an escape
+	bad, cooked := false, false
+	// opening quote
+	ch := s.take()
+	for {
+		if s.input.EOF() {
+			s.setLex(s.text(), ILLEGAL)
+			return &Error{Pos: s.start, Code: ErrUnterminatedString, Msg: "string not terminated"}
+		}
+		switch {
+		case ch == '\n':
+			s.setLex(s.text(), ILLEGAL)
+			return &Error{Pos: s.input.Pos(), Code: ErrNewlineInString, Msg: "newline in string"}
+		case ch == '\'':
+			if ch = s.take(); ch != '\'' {
+				// closing quote
+				str := s.text()
+				switch {
+				case bad:
+					s.setLex(str, ILLEGAL)
+				case len(val) == 1:
+					s.setLex(str, CHAR)
+					s.val = val[0]
+				case cooked:
+					s.setLex(str, STRING)
+					s.val = string(val)
+				default:
+					// the value is the text between the quotes
+					s.setLex(str, STRING)
+					s.val = str[1 : len(str)-1]
+				}
+				s.runes = val
 				return nil
 			}
-		default:
-			if _, ok := keywords[str]; ok {
-				s.setLex(str, keywords[str])
-				// s.input.Next()
-				return nil
+			val = append(val, '\'')
+			cooked = true
+			ch = s.take()
+		case ch == '\\' && s.mode&BackslashEscapes != 0:
+			pos := s.input.Pos()
+			cooked = true
+			if r, ok := s.readEscape(); ok {
+				val = append(val, r)
+			} else {
+				s.error(pos, ErrEscape, "unknown escape sequence")
+				bad = true
 			}
-			return s.input.Collapse("readOp 不合法的字符串")
+			ch = s.input.Peek()
+		default:
+			val = append(val, ch)
+			ch = s.take()
 		}
-		// endswitch
+	}
+}
+
+// readEscape read an escape sequence like \n, \x41 or \u4e2d and returns its char
+func (s *Scanner) readEscape() (rune, bool) {
+	var n int
+	switch ch := s.take(); ch {
+	case 'n':
+		s.take()
+		return '\n', true
+	case 't':
+		s.take()
+		return '\t', true
+	case 'r':
+		s.take()
+		return '\r', true
+	case '0':
+		s.take()
+		return 0, true
+	case '\\', '\'', '"':
+		s.take()
+		return ch, true
+	case 'x':
+		n = 2
+	case 'u':
+		n = 4
 	default:
-		s.input.Next()
-		return s.input.Collapse("readOp 不合法的字符串")
+		return 0, false
+	}
+	s.take()
+	var r rune
+	for ; n > 0; n-- {
+		ch := s.input.Peek()
+		if !IsHexDigit(ch) {
+			return 0, false
+		}
+		d, _ := strconv.ParseUint(string(ch), 16, 8)
+		r = r<<4 | rune(d)
+		s.take()
+	}
+	return r, true
+}
+
+// readID read the identifier and keywords
+func (s *Scanner) readID() error {
+	// first unicode letter, then unicode letters or digits
+	for ch := s.take(); IsLetterOrDigit(ch); {
+		ch = s.take()
+	}
+	str := s.intern()
+	// recognize keywords
+	kw, ok := s.spec.keywords[str]
+	if !ok && s.mode&IgnoreCase != 0 {
+		kw, ok = s.spec.folded[s.fold(str)]
+	}
+	if ok {
+		s.setLex(str, kw)
+		return nil
+	}
+	s.setLex(str, ID)
+	if s.mode&FoldIdents != 0 {
+		s.val = s.fold(str)
 	}
 	return nil
 }
 
-// LexParse write syn to a file
-// func (s *Scanner) LexParse() {
-// 	token, syn := s.Next()
-// 	fmt.Printf("%s,%d>\n", token, syn)
-// 	for !s.EOF() {
-// 		token, syn = s.Next()
-// 		fmt.Printf("%s,%d\n", token, syn)
-// 	}
-// }
-
-// func main() {
-
-// 	program := `9x9x
-// 	0099
-// 	??$$
-// 	++
-// 	begin 9x:=?$00999; if x%><<>9 t99he&n x:=2**x+1/3; end #
-// 	`
-
-// 	scanner := NewScanner(NewInput(program))
-// 	token, syn := scanner.Next()
-// 	fmt.Printf("<'%s', %d>\n", token, syn)
-// 	for !scanner.EOF() {
-// 		token, syn = scanner.Next()
-// 		fmt.Printf("<'%s', %d>\n", token, syn)
-// 	}
-// }
+// fold returns the lower case of the identifier str
+func (s *Scanner) fold(str string) string {
+	if folded, ok := s.folds[str]; ok {
+		return folded
+	}
+	folded := strings.ToLower(str)
+	if folded != str {
+		if s.folds == nil {
+			s.folds = make(map[string]string)
+		}
+		s.folds[str] = folded
+	}
+	return folded
+}
+
+// readOp read the longest operator of the spec by walking its trie,
+// the chars after the last operator prefix are given back to the input
+func (s *Scanner) readOp() error {
+	node := s.spec.ops
+	// the operator is the string in the trie, so it's never copied
+	tok, op := ILLEGAL, ""
+	// the count of chars taken, and the count and bytes of the last operator prefix,
+	// the first char is an unknown operator if no prefix is
+	taken, n, size := 0, 1, 0
+	for !s.input.EOF() {
+		next, ok := node.next[s.input.Peek()]
+		if !ok {
+			break
+		}
+		s.take()
+		if taken++; taken == 1 {
+			size = len(s.lit)
+		}
+		if node = next; node.accept {
+			tok, op, n, size = node.tok, node.op, taken, len(s.lit)
+		}
+	}
+	for ; taken > n; taken-- {
+		s.input.Back()
+	}
+	s.lit = s.lit[:size]
+	if tok == ILLEGAL {
+		str := s.text()
+		return s.collapse(ErrUnknownOp, str, "unknown operator "+str)
+	}
+	s.setLex(op, tok)
+	return nil
+}
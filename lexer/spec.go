@@ -0,0 +1,141 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LexerSpec is the token vocabulary of a language,
+// it lists the keywords and operators with their token kinds,
+// and allocates the token numbers of the language after the builtin tokens
+type LexerSpec struct {
+	keywords map[string]Token
+	// folded are the keywords in lower case for IgnoreCase
+	folded    map[string]Token
+	operators map[string]Token
+	// ops is the trie of operators for maximal munch
+	ops *opNode
+	// names of the tokens defined by Define
+	names map[Token]string
+	// next is the token number for Define
+	next Token
+}
+
+// defaultSpec is the vocabulary of the begin/if/while language
+var defaultSpec *LexerSpec
+
+// init will be called before main function
+func init() {
+	defaultSpec = NewLexerSpec()
+	for i := BEGIN; i <= END; i++ {
+		defaultSpec.Keyword(tokens[i], i)
+	}
+	for i := ADD; i <= RPAREN; i++ {
+		if tokens[i] != "" {
+			defaultSpec.Operator(tokens[i], i)
+		}
+	}
+}
+
+// NewLexerSpec returns an empty spec without keywords and operators
+func NewLexerSpec() *LexerSpec {
+	return &LexerSpec{
+		keywords:  make(map[string]Token),
+		folded:    make(map[string]Token),
+		operators: make(map[string]Token),
+		ops:       newOpNode(),
+		names:     make(map[Token]string),
+		next:      EPISILON,
+	}
+}
+
+// DefaultSpec returns a copy of the begin/if/while language's spec which may be extended
+func DefaultSpec() *LexerSpec {
+	return defaultSpec.Clone()
+}
+
+// Clone returns a copy of the spec
+func (spec *LexerSpec) Clone() *LexerSpec {
+	c := NewLexerSpec()
+	for word, tok := range spec.keywords {
+		c.Keyword(word, tok)
+	}
+	for op, tok := range spec.operators {
+		c.Operator(op, tok)
+	}
+	for tok, name := range spec.names {
+		c.names[tok] = name
+	}
+	c.next = spec.next
+	return c
+}
+
+// Define allocates a new token named name which isn't any builtin token
+func (spec *LexerSpec) Define(name string) Token {
+	tok := spec.next
+	spec.names[tok] = name
+	spec.next++
+	return tok
+}
+
+// Keyword registers word as a keyword of token tok and returns tok
+func (spec *LexerSpec) Keyword(word string, tok Token) Token {
+	spec.keywords[word] = tok
+	spec.folded[strings.ToLower(word)] = tok
+	return tok
+}
+
+// Operator registers op as an operator of token tok and returns tok
+func (spec *LexerSpec) Operator(op string, tok Token) Token {
+	spec.operators[op] = tok
+	node := spec.ops
+	for _, ch := range op {
+		next, ok := node.next[ch]
+		if !ok {
+			next = newOpNode()
+			node.next[ch] = next
+		}
+		node = next
+	}
+	node.op, node.tok, node.accept = op, tok, true
+	return tok
+}
+
+// Epsilon returns the token number after all tokens of the spec,
+// it is the seperation between lex and syntax,
+// so grammars number their nonterminals from it
+func (spec *LexerSpec) Epsilon() Token {
+	return spec.next
+}
+
+// TokenString returns the name of tok in the spec
+func (spec *LexerSpec) TokenString(tok Token) string {
+	if name, ok := spec.names[tok]; ok {
+		return name
+	}
+	return tok.String()
+}
+
+// LexemeString returns lex as "<lit, tok> row:col" with the name of its token in the spec
+func (spec *LexerSpec) LexemeString(lex Lexeme) string {
+	return fmt.Sprintf("<'%s', %s> %v", lex.Lit, spec.TokenString(lex.Tok), lex.Start)
+}
+
+// IsOpStart returns true if ch is the first char of some operators of the spec
+func (spec *LexerSpec) IsOpStart(ch rune) bool {
+	_, ok := spec.ops.next[ch]
+	return ok
+}
+
+// opNode is a node of the operator trie, the path from the root spells a prefix of operators
+type opNode struct {
+	next map[rune]*opNode
+	// accept is true if the prefix is the operator op of token tok
+	accept bool
+	op     string
+	tok    Token
+}
+
+func newOpNode() *opNode {
+	return &opNode{next: make(map[rune]*opNode)}
+}
@@ -0,0 +1,120 @@
+package lexer
+
+// Mark is a position in a Stream to go back to
+type Mark struct {
+	id  int
+	pos int
+	cur Lexeme
+}
+
+// Stream is a buffered token stream over a TokenSource,
+// it looks ahead any count of tokens and backtracks to marks.
+// The tokens are kept only while some marks are outstanding
+type Stream struct {
+	src TokenSource
+	// buf[0] is the token at index base of the stream
+	buf  []Lexeme
+	base int
+	// pos is the index of the next token
+	pos int
+	// marks are the indexes of the outstanding marks by their ids
+	marks  map[int]int
+	nextID int
+	cur    Lexeme
+}
+
+// NewStream creates a token stream over src
+func NewStream(src TokenSource) *Stream {
+	return &Stream{src: src, marks: make(map[int]int)}
+}
+
+// fill scans until the token at index i is buffered
+func (st *Stream) fill(i int) {
+	for i-st.base >= len(st.buf) {
+		st.buf = append(st.buf, st.src.Scan())
+	}
+}
+
+// PeekN returns the k-th token ahead without consuming it, PeekN(1) is the next token
+func (st *Stream) PeekN(k int) Lexeme {
+	if k < 1 {
+		return st.cur
+	}
+	st.fill(st.pos + k - 1)
+	return st.buf[st.pos+k-1-st.base]
+}
+
+// Scan consumes the next token and returns it
+func (st *Stream) Scan() Lexeme {
+	st.cur = st.PeekN(1)
+	st.pos++
+	st.release()
+	return st.cur
+}
+
+// Next returns the next <token, syn>
+func (st *Stream) Next() (string, Token) {
+	st.Scan()
+	return st.Peek()
+}
+
+// Peek returns current <token, syn>
+func (st *Stream) Peek() (string, Token) {
+	return st.cur.Lit, st.cur.Tok
+}
+
+// Lexeme returns current token value with its position
+func (st *Stream) Lexeme() Lexeme {
+	return st.cur
+}
+
+// EOF returns true if token is '#'
+func (st *Stream) EOF() bool {
+	return st.cur.Tok == SHARP && st.cur.Lit == "#"
+}
+
+// Errors returns the lexical errors of the source so far, including those of the tokens looked ahead
+func (st *Stream) Errors() ErrorList {
+	return st.src.Errors()
+}
+
+// Mark returns the mark of the next token, the tokens from it are kept until it's released
+func (st *Stream) Mark() Mark {
+	st.nextID++
+	st.marks[st.nextID] = st.pos
+	return Mark{st.nextID, st.pos, st.cur}
+}
+
+// Reset goes back to mark and releases it
+func (st *Stream) Reset(mark Mark) {
+	if _, ok := st.marks[mark.id]; !ok {
+		panic("lexer: reset to a released mark")
+	}
+	st.pos, st.cur = mark.pos, mark.cur
+	st.Release(mark)
+}
+
+// Release releases mark without going back to it, releasing it again does nothing
+func (st *Stream) Release(mark Mark) {
+	delete(st.marks, mark.id)
+	st.release()
+}
+
+// release drops the consumed tokens before all outstanding marks
+func (st *Stream) release() {
+	keep := st.pos
+	for _, pos := range st.marks {
+		if pos < keep {
+			keep = pos
+		}
+	}
+	if keep == st.base {
+		return
+	}
+	n := copy(st.buf, st.buf[keep-st.base:])
+	for i := n; i < len(st.buf); i++ {
+		st.buf[i] = Lexeme{}
+	}
+	st.buf = st.buf[:n]
+	st.base = keep
+}
@@ -0,0 +1,50 @@
+package lexer
+
+import "fmt"
+
+// Position describes a location of the program
+type Position struct {
+	Filename string // file name, empty for a program without file
+	Offset   int    // byte offset, starting at 0
+	Row      int    // row number, starting at 1
+	Col      int    // column number, starting at 1
+}
+
+// String returns the position as "row:col", or "file:row:col" in a file
+func (pos Position) String() string {
+	if pos.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", pos.Filename, pos.Row, pos.Col)
+	}
+	return fmt.Sprintf("%d:%d", pos.Row, pos.Col)
+}
+
+// TokenSource is a source of tokens which parsers read,
+// Scanner, Stream, Preprocessor and lexgen.Scanner are token sources.
+// Scan reads the next token and returns it, the tokens end with '#' which is returned again after it,
+// Lexeme returns the current token, Next scans and Peek returns the <token, syn> of it,
+// EOF returns true if the current token is the '#',
+// and Errors returns the lexical errors accumulated so far
+type TokenSource interface {
+	Scan() Lexeme
+	Lexeme() Lexeme
+	Next() (string, Token)
+	Peek() (string, Token)
+	EOF() bool
+	Errors() ErrorList
+}
+
+// Lexeme is a token value carrying its kind, literal text and position,
+// End is the position right after the last char of the token.
+// Value is the decoded value of literals: int64 for INTNUM, float64 for REALNUM,
+// string for STRING and rune for CHAR, and the lower case of ID in FoldIdents mode
+type Lexeme struct {
+	Tok        Token
+	Lit        string
+	Start, End Position
+	Value      interface{}
+}
+
+// String returns the lexeme as "<lit, tok> row:col"
+func (lex Lexeme) String() string {
+	return defaultSpec.LexemeString(lex)
+}
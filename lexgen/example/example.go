@@ -0,0 +1,27 @@
+// Package example is a scanner of the begin/if/while language generated by lexgen
+package example
+
+import "github.com/yjhmelody/compiler-lab/lexer"
+
+//go:generate go run gen.go
+
+var keywords = map[string]lexer.Token{
+	"begin": lexer.BEGIN,
+	"if":    lexer.IF,
+	"then":  lexer.THEN,
+	"while": lexer.WHILE,
+	"do":    lexer.DO,
+	"end":   lexer.END,
+}
+
+// NewScanner creates a generated scanner which recognizes the keywords
+func NewScanner(program string) *LabScanner {
+	s := NewLabScanner(program)
+	s.Action = func(rule int, text string) (lexer.Token, bool) {
+		if tok, ok := keywords[text]; ok {
+			return tok, true
+		}
+		return lexer.ID, true
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/yjhmelody/compiler-lab/lexer"
+)
+
+func TestLabScanner(t *testing.T) {
+	for _, program := range []string{
+		"begin x:=9; if x>=9 then x:=2*(x+1)/3; while x<>0 do x:=x-1 end ?? y",
+		"begin x:=9 end # ?? not scanned",
+	} {
+		want := lexer.NewScanner(lexer.NewInput(program))
+		s := NewScanner(program)
+		for {
+			wantTok, wantSyn := want.Next()
+			tok, syn := s.Next()
+			if tok != wantTok || syn != wantSyn {
+				t.Errorf("got <%s, %v>, expected <%s, %v>", tok, syn, wantTok, wantSyn)
+			}
+			if s.EOF() || want.EOF() {
+				break
+			}
+		}
+		if tok, syn := s.Next(); !s.EOF() || syn != lexer.SHARP {
+			t.Errorf("got <%s, %v> after the end", tok, syn)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build ignore
+// +build ignore
+
+// gen writes scanner.go of the begin/if/while language from lexgen.LabRules
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/yjhmelody/compiler-lab/lexgen"
+)
+
+func main() {
+	l, err := lexgen.New(lexgen.LabRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := os.Create("scanner.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := l.WriteGo(f, "example", "LabScanner"); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,259 @@
+package lexgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"reflect"
+	"strconv"
+
+	"github.com/yjhmelody/compiler-lab/DFA"
+	"github.com/yjhmelody/compiler-lab/lexer"
+)
+
+// isSkip returns true if action is Skip
+func isSkip(action Action) bool {
+	return action != nil && reflect.ValueOf(action).Pointer() == reflect.ValueOf(Skip).Pointer()
+}
+
+// tokenNames are the names of the token constants of package lexer,
+// the generated scanners refer to them so they survive renumbering
+var tokenNames = map[lexer.Token]string{
+	lexer.SHARP:    "SHARP",
+	lexer.BEGIN:    "BEGIN",
+	lexer.IF:       "IF",
+	lexer.THEN:     "THEN",
+	lexer.WHILE:    "WHILE",
+	lexer.DO:       "DO",
+	lexer.END:      "END",
+	lexer.ID:       "ID",
+	lexer.INTNUM:   "INTNUM",
+	lexer.REALNUM:  "REALNUM",
+	lexer.ADD:      "ADD",
+	lexer.SUB:      "SUB",
+	lexer.MUL:      "MUL",
+	lexer.QUO:      "QUO",
+	lexer.COLON:    "COLON",
+	lexer.ASSIGN:   "ASSIGN",
+	lexer.LSS:      "LSS",
+	lexer.NEQ:      "NEQ",
+	lexer.LEQ:      "LEQ",
+	lexer.GTR:      "GTR",
+	lexer.GEQ:      "GEQ",
+	lexer.EQ:       "EQ",
+	lexer.SEMCOLON: "SEMCOLON",
+	lexer.LPAREN:   "LPAREN",
+	lexer.RPAREN:   "RPAREN",
+	lexer.STRING:   "STRING",
+	lexer.CHAR:     "CHAR",
+	lexer.ILLEGAL:  "ILLEGAL",
+	lexer.COMMENT:  "COMMENT",
+	lexer.NEWLINE:  "NEWLINE",
+	lexer.INDENT:   "INDENT",
+	lexer.DEDENT:   "DEDENT",
+}
+
+// tokenExpr returns the Go expression of tok, the tokens defined by a LexerSpec are numbers
+func tokenExpr(tok lexer.Token) string {
+	if name, ok := tokenNames[tok]; ok {
+		return "lexer." + name
+	}
+	return "lexer.Token(" + strconv.Itoa(int(tok)) + ")"
+}
+
+// WriteGo writes a standalone Go file of package pkg which declares the scanner type name,
+// the state machine of the lexer is emitted as goto statements instead of a table.
+// The text of Skip rules is skipped, and the rules with other actions call the Action field
+// of the generated scanner, which falls back to the rule's token when it's nil
+func (l *Lexer) WriteGo(w io.Writer, pkg, name string) error {
+	var buf bytes.Buffer
+	g := &generator{buf: &buf, lexer: l, name: name}
+	g.printf("// Code generated by lexgen. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", pkg)
+	g.printf("import (\n\t\"unicode/utf8\"\n\n\t\"github.com/yjhmelody/compiler-lab/lexer\"\n)\n\n")
+	g.header()
+	g.rules()
+	g.match()
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// generator writes the Go source of a lexer
+type generator struct {
+	buf   *bytes.Buffer
+	lexer *Lexer
+	name  string
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format, args...)
+}
+
+// header writes the scanner type and its methods
+func (g *generator) header() {
+	g.printf(`// %[1]s scans tokens by a generated state machine,
+// its EOF, Peek and Next are those of lexer.TokenSource
+type %[1]s struct {
+	program  string
+	position int
+	token    string
+	syn      lexer.Token
+	done     bool
+	// Action decides the token of the text matched by a rule with an action,
+	// the rule's token is used when it is nil
+	Action func(rule int, text string) (lexer.Token, bool)
+}
+
+// New%[1]s creates a scanner of program
+func New%[1]s(program string) *%[1]s {
+	return &%[1]s{program: program}
+}
+
+// EOF returns true if token is '#'
+func (s *%[1]s) EOF() bool {
+	return s.done
+}
+
+// Peek returns current <token, syn>
+func (s *%[1]s) Peek() (string, lexer.Token) {
+	return s.token, s.syn
+}
+
+// Next returns the next <token, syn>
+func (s *%[1]s) Next() (string, lexer.Token) {
+	for !s.done {
+		if s.position >= len(s.program) {
+			s.token, s.syn, s.done = "#", lexer.SHARP, true
+			return s.Peek()
+		}
+		n, rule := s.match(s.program[s.position:])
+		if rule < 0 {
+			// skip the chars until some rule matches
+			start := s.position
+			for rule < 0 && s.position < len(s.program) {
+				_, width := utf8.DecodeRuneInString(s.program[s.position:])
+				s.position += width
+				n, rule = s.match(s.program[s.position:])
+			}
+			s.token, s.syn = s.program[start:s.position], lexer.ILLEGAL
+			return s.Peek()
+		}
+		text := s.program[s.position : s.position+n]
+		s.position += n
+		r := %[2]sRules[rule]
+		tok, ok := r.tok, !r.skip
+		if r.action && s.Action != nil {
+			tok, ok = s.Action(rule, text)
+		}
+		if ok {
+			s.token, s.syn, s.done = text, tok, tok == lexer.SHARP
+			return s.Peek()
+		}
+	}
+	return s.Peek()
+}
+
+`, g.name, lower(g.name))
+}
+
+// rules writes the table of rules
+func (g *generator) rules() {
+	g.printf("// %sRules are the tokens and actions of the rules\n", lower(g.name))
+	g.printf("var %sRules = [...]struct {\n\ttok lexer.Token\n\tskip, action bool\n}{\n", lower(g.name))
+	for i, rule := range g.lexer.rules {
+		skip := isSkip(rule.Action)
+		action := rule.Action != nil && !skip
+		g.printf("\t%d: {%s, %t, %t}, // %s\n", i, tokenExpr(rule.Tok), skip, action, strconv.Quote(rule.Pattern))
+	}
+	g.printf("}\n\n")
+}
+
+// match writes the state machine which finds the longest match and its rule
+func (g *generator) match() {
+	t := g.lexer.table
+	g.printf(`// match returns the length of the longest match at the start of src and its rule,
+// the rule is -1 if nothing matches
+func (s *%s) match(src string) (n, rule int) {
+	rule = -1
+	i := 0
+	var ch byte
+	goto s0
+`, g.name)
+	for state := 0; state < t.Len(); state++ {
+		g.printf("s%d:\n", state)
+		if tag := t.Final[state]; tag >= 0 {
+			g.printf("\tn, rule = i, %d\n", tag)
+		}
+		order, cases := t.Edges(state)
+		if len(order) == 0 {
+			g.printf("\treturn\n")
+			continue
+		}
+		g.printf("\tif i >= len(src) {\n\t\treturn\n\t}\n")
+		g.printf("\tch = src[i]\n\ti++\n\tswitch {\n")
+		for _, next := range order {
+			g.printf("\tcase ")
+			for j, r := range cases[next] {
+				if j > 0 {
+					g.printf(" || ")
+				}
+				if r.Lo == r.Hi {
+					g.printf("ch == %s", quoteByte(r.Lo))
+				} else {
+					g.printf("ch >= %s && ch <= %s", quoteByte(r.Lo), quoteByte(r.Hi))
+				}
+			}
+			g.printf(":\n\t\tgoto s%d\n", next)
+		}
+		g.printf("\t}\n\treturn\n")
+	}
+	g.printf("}\n")
+}
+
+// label returns the label of the rule of tag in diagrams, it is the token of the rule
+func (l *Lexer) label(tag int) string {
+	if isSkip(l.rules[tag].Action) {
+		return "skip"
+	}
+	return l.rules[tag].Tok.String()
+}
+
+// DFA returns the DFA.DFA of the lexer,
+// each accepting state is a terminal state labelled by the token it produces
+func (l *Lexer) DFA() *DFA.DFA {
+	return l.table.DFA(l.label)
+}
+
+// WriteDot writes the state-transition diagram of the lexer in the DOT language of Graphviz
+// by the GraphViz of its DFA
+func (l *Lexer) WriteDot(w io.Writer) error {
+	_, err := io.WriteString(w, l.DFA().GraphViz()+"\n")
+	return err
+}
+
+// WriteTable writes the transition table of the lexer,
+// each accepting state is labelled by the token it produces
+func (l *Lexer) WriteTable(w io.Writer) error {
+	return l.table.WriteTable(w, l.label)
+}
+
+// quoteByte returns the Go literal of byte b
+func quoteByte(b int) string {
+	if b >= ' ' && b < 0x7f {
+		return strconv.QuoteRune(rune(b))
+	}
+	return fmt.Sprintf("0x%02x", b)
+}
+
+// lower returns name with its first letter in lower case
+func lower(name string) string {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return name
+	}
+	return string(name[0]-'A'+'a') + name[1:]
+}
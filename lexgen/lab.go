@@ -0,0 +1,74 @@
+package lexgen
+
+import (
+	"github.com/yjhmelody/compiler-lab/lexer"
+)
+
+var labKeywords = map[string]lexer.Token{
+	"begin": lexer.BEGIN,
+	"if":    lexer.IF,
+	"then":  lexer.THEN,
+	"while": lexer.WHILE,
+	"do":    lexer.DO,
+	"end":   lexer.END,
+}
+
+// LabRules are the rules of the begin/if/while language
+var LabRules = append([]Rule{
+	{Pattern: `[ \t\r\n]+`, Action: Skip},
+	{Pattern: `[a-zA-Z][a-zA-Z0-9]*`, Tok: lexer.ID, Action: Keyword},
+	{Pattern: `0|[1-9]\d*`, Tok: lexer.INTNUM},
+}, labOperators...)
+
+// LexerRules are the rules of all tokens lexer.Scanner reads with the default spec,
+// letters are only ASCII ones, and a comment ends at its first closer
+// because nested comments aren't regular
+var LexerRules = lexerRules()
+
+// lexerRules returns LexerRules, each keyword has its own rule ahead of the identifier one
+// so that it wins over an identifier of the same length and gets its own accepting state
+func lexerRules() []Rule {
+	rules := []Rule{
+		{Pattern: `[ \t\r\n]+`, Action: Skip},
+		{Pattern: `\{[^}]*\}|\(\*([^*]|\*+[^*)])*\*+\)|//[^\n]*`, Tok: lexer.COMMENT},
+	}
+	for tok := lexer.BEGIN; tok <= lexer.END; tok++ {
+		rules = append(rules, Rule{Pattern: tok.String(), Tok: tok})
+	}
+	rules = append(rules, []Rule{
+		{Pattern: `[a-zA-Z][a-zA-Z0-9]*`, Tok: lexer.ID},
+		{Pattern: `0|[1-9]\d*|\$[0-9a-fA-F]+|0[xX][0-9a-fA-F]+`, Tok: lexer.INTNUM},
+		{Pattern: `(0|[1-9]\d*)(\.\d+([eE][+-]?\d+)?|[eE][+-]?\d+)`, Tok: lexer.REALNUM},
+		{Pattern: `'([^'\n]|'')'`, Tok: lexer.CHAR},
+		{Pattern: `'([^'\n]|'')*'`, Tok: lexer.STRING},
+	}...)
+	return append(rules, labOperators...)
+}
+
+// labOperators are the rules of the operators, delimiters and the end char '#'
+var labOperators = []Rule{
+	{Pattern: `\+`, Tok: lexer.ADD},
+	{Pattern: "-", Tok: lexer.SUB},
+	{Pattern: `\*`, Tok: lexer.MUL},
+	{Pattern: "/", Tok: lexer.QUO},
+	{Pattern: ":", Tok: lexer.COLON},
+	{Pattern: ":=", Tok: lexer.ASSIGN},
+	{Pattern: "<", Tok: lexer.LSS},
+	{Pattern: "<>", Tok: lexer.NEQ},
+	{Pattern: "<=", Tok: lexer.LEQ},
+	{Pattern: ">", Tok: lexer.GTR},
+	{Pattern: ">=", Tok: lexer.GEQ},
+	{Pattern: "=", Tok: lexer.EQ},
+	{Pattern: ";", Tok: lexer.SEMCOLON},
+	{Pattern: `\(`, Tok: lexer.LPAREN},
+	{Pattern: `\)`, Tok: lexer.RPAREN},
+	{Pattern: "#", Tok: lexer.SHARP},
+}
+
+// Keyword is the Action of the identifier rule which recognizes the keywords
+func Keyword(text string) (lexer.Token, bool) {
+	if tok, ok := labKeywords[text]; ok {
+		return tok, true
+	}
+	return lexer.ID, true
+}
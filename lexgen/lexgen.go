@@ -0,0 +1,182 @@
+package lexgen
+
+import (
+	"errors"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/yjhmelody/compiler-lab/DFA"
+	"github.com/yjhmelody/compiler-lab/NFA"
+	"github.com/yjhmelody/compiler-lab/lexer"
+)
+
+// Action is called with the text matched by a rule,
+// it returns the token of the text, or false to skip the text like whitespace
+type Action func(text string) (lexer.Token, bool)
+
+// Skip is the Action of rules whose text is skipped
+func Skip(text string) (lexer.Token, bool) {
+	return lexer.ILLEGAL, false
+}
+
+// Rule maps the text matched by the regex Pattern to the token Tok,
+// if Action isn't nil, it decides the token instead.
+// The scan ends at a token of lexer.SHARP like at the end of the program
+type Rule struct {
+	Pattern string
+	Tok     lexer.Token
+	Action  Action
+}
+
+// Lexer is a table-driven scanner generated from rules,
+// the longest match wins and the first rule wins for the same length
+type Lexer struct {
+	rules []Rule
+	table *DFA.Table
+}
+
+// New compiles rules through Thompson construction, subset construction and minimization
+func New(rules []Rule) (*Lexer, error) {
+	nfas := make([]*NFA.NFA, len(rules))
+	for i, rule := range rules {
+		nfa, err := NFA.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.New("rule " + strconv.Itoa(i) + " " + rule.Pattern + ": " + err.Error())
+		}
+		nfas[i] = nfa
+	}
+	nfa, accepts := NFA.Union(nfas...)
+	tags := make(map[NFA.State]int)
+	for i, s := range accepts {
+		tags[s] = i
+	}
+	return &Lexer{
+		rules: rules,
+		table: DFA.Subset(nfa, tags).Minimize(),
+	}, nil
+}
+
+// Table returns the transition table of the lexer, the final tags are rule indexes
+func (l *Lexer) Table() *DFA.Table {
+	return l.table
+}
+
+// match returns the length of the longest match at the start of src and its rule,
+// the rule is -1 if nothing matches
+func (l *Lexer) match(src string) (int, int) {
+	n, rule := 0, -1
+	for i, state := 0, 0; i < len(src); i++ {
+		state = l.table.Trans[state][src[i]]
+		if state < 0 {
+			break
+		}
+		if tag := l.table.Final[state]; tag >= 0 {
+			n, rule = i+1, tag
+		}
+	}
+	return n, rule
+}
+
+// NewScanner creates a scanner of program
+func (l *Lexer) NewScanner(program string) *Scanner {
+	return &Scanner{
+		lexer:   l,
+		program: program,
+		row:     1,
+		col:     1,
+	}
+}
+
+// Scanner scans tokens by the lexer's table, it is a lexer.TokenSource
+type Scanner struct {
+	lexer              *Lexer
+	program            string
+	position, row, col int
+	lex                lexer.Lexeme
+	errors             lexer.ErrorList
+	// done is true after the token of lexer.SHARP
+	done bool
+}
+
+// Errors returns all lexical errors accumulated so far
+func (s *Scanner) Errors() lexer.ErrorList {
+	return s.errors
+}
+
+// EOF returns true if token is '#'
+func (s *Scanner) EOF() bool {
+	return s.done
+}
+
+// Peek returns current <token, syn>
+func (s *Scanner) Peek() (string, lexer.Token) {
+	return s.lex.Lit, s.lex.Tok
+}
+
+// Next returns the next <token, syn>
+func (s *Scanner) Next() (string, lexer.Token) {
+	s.Scan()
+	return s.Peek()
+}
+
+// Lexeme returns current token value with its position
+func (s *Scanner) Lexeme() lexer.Lexeme {
+	return s.lex
+}
+
+// Scan reads the next token and returns its value with position
+func (s *Scanner) Scan() lexer.Lexeme {
+	if s.done {
+		return s.lex
+	}
+	for {
+		start := s.pos()
+		if s.position >= len(s.program) {
+			s.lex = lexer.Lexeme{Tok: lexer.SHARP, Lit: "#", Start: start, End: start}
+			s.done = true
+			return s.lex
+		}
+		n, rule := s.lexer.match(s.program[s.position:])
+		if rule < 0 {
+			// skip the chars until some rule matches
+			for rule < 0 && s.position < len(s.program) {
+				_, width := utf8.DecodeRuneInString(s.program[s.position:])
+				s.advance(width)
+				n, rule = s.lexer.match(s.program[s.position:])
+			}
+			lit := s.program[start.Offset:s.position]
+			s.errors.Add(start, lexer.ErrIllegalChar, "no rule matches "+strconv.Quote(lit))
+			s.lex = lexer.Lexeme{Tok: lexer.ILLEGAL, Lit: lit, Start: start, End: s.pos()}
+			return s.lex
+		}
+		lit := s.program[s.position : s.position+n]
+		s.advance(n)
+		tok, ok := s.lexer.rules[rule].Tok, true
+		if action := s.lexer.rules[rule].Action; action != nil {
+			tok, ok = action(lit)
+		}
+		if ok {
+			s.lex = lexer.Lexeme{Tok: tok, Lit: lit, Start: start, End: s.pos()}
+			s.done = tok == lexer.SHARP
+			return s.lex
+		}
+	}
+}
+
+// pos returns the position of current char
+func (s *Scanner) pos() lexer.Position {
+	return lexer.Position{Offset: s.position, Row: s.row, Col: s.col}
+}
+
+// advance moves n bytes forward, the col is counted in chars
+func (s *Scanner) advance(n int) {
+	for _, ch := range s.program[s.position : s.position+n] {
+		if ch == '\n' {
+			s.row++
+			s.col = 1
+		} else {
+			s.col++
+		}
+	}
+	s.position += n
+}
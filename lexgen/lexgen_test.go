@@ -0,0 +1,142 @@
+package lexgen
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/yjhmelody/compiler-lab/lexer"
+)
+
+func TestLexer(t *testing.T) {
+	l, err := New(LabRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, program := range []string{
+		"begin x:=9; if x>=9 then x:=2*(x+1)/3; while x<>0 do x:=x-1 end",
+		"begin x:=9 end # ?? not scanned",
+	} {
+		want := lexer.NewScanner(lexer.NewInput(program))
+		s := l.NewScanner(program)
+		for {
+			w, lex := want.Scan(), s.Scan()
+			if lex.Tok != w.Tok || lex.Lit != w.Lit || lex.Start != w.Start || lex.End != w.End {
+				t.Errorf("got %v, expected %v", lex, w)
+			}
+			if s.EOF() || want.EOF() {
+				break
+			}
+		}
+		if lex := s.Scan(); !s.EOF() || lex.Tok != lexer.SHARP || len(s.Errors()) != 0 {
+			t.Errorf("got %v with errors %v after the end", lex, s.Errors())
+		}
+	}
+}
+
+func TestLexerRules(t *testing.T) {
+	l, err := New(LexerRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := "begin { x } x:=1.5e3; (* y *) y:=$FF+0x1f-2E-2; // z\n" +
+		"if x<>0 then s:='it''s' else c:='''' end # not scanned"
+	want := lexer.NewScanner(lexer.NewInput(program))
+	want.SetMode(lexer.ScanComments)
+	s := l.NewScanner(program)
+	for {
+		w, lex := want.Scan(), s.Scan()
+		if lex.Tok != w.Tok || lex.Lit != w.Lit || lex.Start != w.Start || lex.End != w.End {
+			t.Errorf("got %v, expected %v", lex, w)
+		}
+		if s.EOF() || want.EOF() {
+			break
+		}
+	}
+	if len(s.Errors()) != 0 || len(want.Errors()) != 0 {
+		t.Errorf("got errors %v and %v", s.Errors(), want.Errors())
+	}
+
+	var dot strings.Builder
+	if err := l.WriteDot(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range LexerRules[1:] {
+		if label := `\n` + rule.Tok.String() + `"];`; !strings.Contains(dot.String(), label) {
+			t.Errorf("no accepting state of %v in\n%s", rule.Tok, dot.String())
+		}
+	}
+}
+
+// the scanners of a lexer are token sources for parsers
+var _ lexer.TokenSource = (*Scanner)(nil)
+
+func TestLexerErrors(t *testing.T) {
+	l, err := New(LabRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := l.NewScanner("x ?? y")
+	var toks []lexer.Token
+	for s.Scan(); !s.EOF(); s.Scan() {
+		toks = append(toks, s.Lexeme().Tok)
+	}
+	if len(toks) != 3 || toks[1] != lexer.ILLEGAL {
+		t.Errorf("got %v, expected [id illegal id]", toks)
+	}
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Pos.Col != 3 {
+		t.Errorf("got errors %v, expected one at 1:3", errs)
+	}
+
+	if _, err := New([]Rule{{Pattern: "(a", Tok: lexer.ID}}); err == nil {
+		t.Error("expected an error for (a")
+	}
+}
+
+func TestWriteGo(t *testing.T) {
+	spec := lexer.DefaultSpec()
+	dotdot := spec.Define("..")
+	l, err := New([]Rule{{Pattern: `\+`, Tok: lexer.ADD}, {Pattern: `\.\.`, Tok: dotdot}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src strings.Builder
+	if err := l.WriteGo(&src, "gen", "Scanner"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range []string{"{lexer.ADD, false, false}", "{lexer.Token(" + strconv.Itoa(int(dotdot)) + "), false, false}"} {
+		if !strings.Contains(src.String(), tok) {
+			t.Errorf("no rule %s in\n%s", tok, src.String())
+		}
+	}
+}
+
+func TestDiagram(t *testing.T) {
+	l, err := New(LabRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dot, table strings.Builder
+	if err := l.WriteDot(&dot); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.WriteTable(&table); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range LabRules[1:] {
+		label := `\n` + rule.Tok.String() + `"];`
+		if !strings.Contains(dot.String(), label) {
+			t.Errorf("no accepting state of %v in\n%s", rule.Tok, dot.String())
+		}
+	}
+	if n := strings.Count(dot.String(), "doublecircle"); n != 20 {
+		t.Errorf("got %d accepting states, expected 20", n)
+	}
+	if !strings.Contains(dot.String(), `"s11" -> "s17" [label="="];`) {
+		t.Errorf("no edge from : to := in\n%s", dot.String())
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != l.Table().Len()+1 || !strings.HasPrefix(lines[0], "state") {
+		t.Errorf("got table\n%s", table.String())
+	}
+}
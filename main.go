@@ -10,6 +10,6 @@ import (
 func main() {
 	program := `id +++ id3`
 	// fmt.Scanf("%s", program)
-	ok := LL1.Analysis(lexer.NewScanner(lexer.NewInput(program)))
+	ok := LL1.Analysis(lexer.NewScanner(lexer.NewInput(program)), nil)
 	fmt.Println("recognize?", ok)
 }
@@ -62,8 +62,8 @@ func parse_M() {
 func parse_D() bool {
 
 	// id : T D2
-	if tok, syn := scanner.Next(); syn == lexer.ID {
-		if _, syn := scanner.Next(); syn == lexer.COLON {
+	if id := scanner.Scan(); id.Tok == lexer.ID {
+		if colon := scanner.Scan(); colon.Tok == lexer.COLON {
 
 			parse_T()
 
@@ -87,7 +87,7 @@ func parse_D() bool {
 
 			// enter(top(tblptr),id.name,T.type,top(offset));
 			// top(offset) = top(offset) + T.width
-			st.enter(tok, Tvalue["type"], offset)
+			st.enter(id.Lit, Tvalue["type"], offset)
 			offsets.Pop()
 			width, err := strconv.Atoi(Tvalue["width"])
 			if err != nil {
@@ -95,30 +95,35 @@ func parse_D() bool {
 			}
 			offsets.Push(width + offset)
 			parse_D2()
+		} else {
+			fmt.Println("D error: expected ':' but got", spec.LexemeString(colon))
 		}
+	} else if id.Tok != lexer.SHARP {
+		fmt.Println("D error: expected id but got", spec.LexemeString(id))
 	}
 	return false
 }
 
 func parse_T() string {
-	tok, _ := scanner.Next()
+	lex := scanner.Scan()
+	tok := lex.Lit
 
 	// T.type = integer; T.width = 4
 	// T.type = real; T.width = 8
 	// T.type = pointer(T1.type); T.width = 4
-	switch tok {
-	case "integer":
+	switch lex.Tok {
+	case INTEGER:
 		Tvalue["type"] = tok
 		Tvalue["width"] = "4"
-	case "real":
+	case REAL:
 		Tvalue["type"] = tok
 		Tvalue["width"] = "8"
-	case "ptr":
+	case PTR:
 		Tvalue["type"] = tok + " " + parse_T()
 		// Tvalue["type"] = tok + T2["type"]
 		Tvalue["width"] = "4"
 	default:
-		fmt.Println("T error")
+		fmt.Println("T error: unknown type", spec.LexemeString(lex))
 		panic("parse_T")
 	}
 
@@ -134,7 +139,7 @@ func parse_D2() {
 
 func main() {
 	program := `id1:real; id2:ptr integer; id3:integer; id4: real;`
-	Parse(lexer.NewScanner(lexer.NewInput(program)))
+	Parse(lexer.NewSpecScanner(lexer.NewInput(program), spec))
 	fmt.Println("width", symbolTable.width)
 	for k, v := range symbolTable.symbols {
 		fmt.Println(k, v)
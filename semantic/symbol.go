@@ -47,13 +47,20 @@ func (st *SymbolTable) enterproc(name string, s Symbol) {
 	st.symbols[name] = s
 }
 
-// defined for syntax
-const (
-	// 29
-	EPISILON lexer.Token = lexer.EPISILON + iota
-	P
-	M
-	D
-	D2
-	T
+// spec is the token vocabulary of declarations, the type names are its keywords
+var (
+	spec    = lexer.DefaultSpec()
+	INTEGER = spec.Keyword("integer", spec.Define("integer"))
+	REAL    = spec.Keyword("real", spec.Define("real"))
+	PTR     = spec.Keyword("ptr", spec.Define("ptr"))
+)
+
+// defined for syntax, they are numbered after the tokens of spec
+var (
+	EPISILON = spec.Epsilon()
+	P        = EPISILON + 1
+	M        = EPISILON + 2
+	D        = EPISILON + 3
+	D2       = EPISILON + 4
+	T        = EPISILON + 5
 )
@@ -0,0 +1,284 @@
+// tokdump reads a program from files or stdin and writes its token stream,
+// in the classic <token, syn> two-tuple, JSON lines or CSV.
+// The tokens of several files are written one file after another,
+// and their positions and errors name the file.
+// With -diagram, it writes the state-transition diagram of the scanner generated from lexgen.LexerRules,
+// the regular rules of all tokens of the lexer.
+//
+//	tokdump [-format classic|json|csv] [-o file] [-comments] [-escapes] [-nocase] [-layout] [file...]
+//	tokdump -diagram dot|table [-o file]
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/yjhmelody/compiler-lab/lexer"
+	"github.com/yjhmelody/compiler-lab/lexgen"
+)
+
+// position is the JSON form of lexer.Position
+type position struct {
+	Filename string `json:"file,omitempty"`
+	Offset   int    `json:"offset"`
+	Row      int    `json:"row"`
+	Col      int    `json:"col"`
+}
+
+// token is the JSON form of lexer.Lexeme
+type token struct {
+	Kind  string      `json:"kind"`
+	Syn   int         `json:"syn"`
+	Text  string      `json:"text"`
+	Start position    `json:"start"`
+	End   position    `json:"end"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// writer writes the tokens in some format
+type writer interface {
+	Write(lex lexer.Lexeme) error
+	Flush() error
+}
+
+// classicWriter writes <'token', syn>, a token without text like INDENT is written by its name
+type classicWriter struct {
+	w    *bufio.Writer
+	spec *lexer.LexerSpec
+}
+
+func (cw classicWriter) Write(lex lexer.Lexeme) error {
+	text := lex.Lit
+	if text == "" {
+		text = cw.spec.TokenString(lex.Tok)
+	}
+	_, err := fmt.Fprintf(cw.w, "<'%s', %d>\n", text, lex.Tok)
+	return err
+}
+
+func (cw classicWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// jsonWriter writes a JSON object per line
+type jsonWriter struct {
+	w    *bufio.Writer
+	enc  *json.Encoder
+	spec *lexer.LexerSpec
+}
+
+func (jw jsonWriter) Write(lex lexer.Lexeme) error {
+	return jw.enc.Encode(token{
+		Kind:  jw.spec.TokenString(lex.Tok),
+		Syn:   int(lex.Tok),
+		Text:  lex.Lit,
+		Start: position(lex.Start),
+		End:   position(lex.End),
+		Value: jsonValue(lex.Value),
+	})
+}
+
+func (jw jsonWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+// jsonValue returns the JSON form of a decoded value, a char is written as a string
+func jsonValue(val interface{}) interface{} {
+	if ch, ok := val.(rune); ok {
+		return string(ch)
+	}
+	return val
+}
+
+// csvWriter writes a record per token with a header
+type csvWriter struct {
+	w      *csv.Writer
+	spec   *lexer.LexerSpec
+	header bool
+}
+
+func (cw *csvWriter) Write(lex lexer.Lexeme) error {
+	if !cw.header {
+		cw.header = true
+		err := cw.w.Write([]string{"kind", "syn", "text", "offset", "row", "col", "end_offset", "end_row", "end_col", "value", "file"})
+		if err != nil {
+			return err
+		}
+	}
+	value := ""
+	if lex.Value != nil {
+		value = fmt.Sprint(jsonValue(lex.Value))
+	}
+	return cw.w.Write([]string{
+		cw.spec.TokenString(lex.Tok), strconv.Itoa(int(lex.Tok)), lex.Lit,
+		strconv.Itoa(lex.Start.Offset), strconv.Itoa(lex.Start.Row), strconv.Itoa(lex.Start.Col),
+		strconv.Itoa(lex.End.Offset), strconv.Itoa(lex.End.Row), strconv.Itoa(lex.End.Col),
+		value, lex.Start.Filename,
+	})
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// newWriter returns the writer of the format, the tokens are named by spec
+func newWriter(format string, w io.Writer, spec *lexer.LexerSpec) (writer, error) {
+	switch format {
+	case "classic":
+		return classicWriter{bufio.NewWriter(w), spec}, nil
+	case "json":
+		bw := bufio.NewWriter(w)
+		return jsonWriter{bw, json.NewEncoder(bw), spec}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w), spec: spec}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// dump writes all tokens of s until '#'
+func dump(s *lexer.Scanner, w writer) error {
+	for {
+		lex := s.Scan()
+		if err := w.Write(lex); err != nil {
+			return err
+		}
+		if s.EOF() {
+			return w.Flush()
+		}
+	}
+}
+
+// writeDiagram writes the state-transition diagram of the lexer's tokens in the format dot or table
+func writeDiagram(format string, w io.Writer) error {
+	l, err := lexgen.New(lexgen.LexerRules)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "dot":
+		return l.WriteDot(w)
+	case "table":
+		return l.WriteTable(w)
+	}
+	return fmt.Errorf("unknown diagram format %q", format)
+}
+
+// dumpInput writes all tokens of the input in the language of spec,
+// the lexical errors are written to stderr, it returns the count of lexical errors
+func dumpInput(input *lexer.Input, spec *lexer.LexerSpec, mode lexer.Mode, w writer, stderr io.Writer) (int, error) {
+	s := lexer.NewSpecScanner(input, spec)
+	s.SetMode(mode)
+	s.SetErrorHandler(func(pos lexer.Position, code lexer.ErrorCode, msg string) {
+		fmt.Fprintln(stderr, pos, msg)
+	})
+	if err := dump(s, w); err != nil {
+		return s.ErrorCount, err
+	}
+	return s.ErrorCount, input.Err()
+}
+
+// dumpFile writes all tokens of the file name which is read incrementally and added to fset
+func dumpFile(fset *lexer.FileSet, name string, spec *lexer.LexerSpec, mode lexer.Mode, w writer, stderr io.Writer) (int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	input := fset.AddReaderFile(name, int(info.Size())).NewReaderInput(f)
+	return dumpInput(input, spec, mode, w, stderr)
+}
+
+// run runs tokdump with the command line args and returns the exit code,
+// which is 1 for lexical errors and 2 for other errors
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tokdump", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		format   = flags.String("format", "classic", "output format: classic, json or csv")
+		output   = flags.String("o", "", "write the tokens to the file instead of stdout")
+		comments = flags.Bool("comments", false, "dump comments as tokens")
+		escapes  = flags.Bool("escapes", false, "decode backslash escapes in strings")
+		nocase   = flags.Bool("nocase", false, "match keywords case-insensitively and fold identifiers")
+		layout   = flags.Bool("layout", false, "dump NEWLINE, INDENT and DEDENT tokens of the line structure")
+		diagram  = flags.String("diagram", "", "write the state-transition diagram of the scanner as dot or table instead")
+	)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	out := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer f.Close()
+		out = f
+	}
+	if *diagram != "" {
+		if err := writeDiagram(*diagram, out); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		return 0
+	}
+	spec := lexer.DefaultSpec()
+	w, err := newWriter(*format, out, spec)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var mode lexer.Mode
+	if *comments {
+		mode |= lexer.ScanComments
+	}
+	if *escapes {
+		mode |= lexer.BackslashEscapes
+	}
+	if *nocase {
+		mode |= lexer.IgnoreCase | lexer.FoldIdents
+	}
+	if *layout {
+		mode |= lexer.Layout
+	}
+
+	// stdin and the files are read incrementally, the files are added to a file set
+	errors := 0
+	if flags.NArg() == 0 {
+		n, err := dumpInput(lexer.NewReaderInput(stdin), spec, mode, w, stderr)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		errors += n
+	}
+	fset := lexer.NewFileSet()
+	for _, name := range flags.Args() {
+		n, err := dumpFile(fset, name, spec, mode, w, stderr)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		errors += n
+	}
+	if errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the string has a comma and quotes which CSV has to quote
+const testProgram = "x:='a,\"b'''\n"
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		args []string
+		in   string
+		out  string
+		code int
+	}{
+		{
+			[]string{"-format", "classic"}, testProgram,
+			"<'x', 10>\n<':=', 18>\n<''a,\"b'''', 29>\n<'#', 0>\n", 0,
+		},
+		{
+			[]string{"-format", "json"}, testProgram,
+			`{"kind":"id","syn":10,"text":"x","start":{"offset":0,"row":1,"col":1},"end":{"offset":1,"row":1,"col":2}}
+{"kind":":=","syn":18,"text":":=","start":{"offset":1,"row":1,"col":2},"end":{"offset":3,"row":1,"col":4}}
+{"kind":"string","syn":29,"text":"'a,\"b'''","start":{"offset":3,"row":1,"col":4},"end":{"offset":11,"row":1,"col":12},"value":"a,\"b'"}
+{"kind":"#","syn":0,"text":"#","start":{"offset":12,"row":2,"col":1},"end":{"offset":12,"row":2,"col":1}}
+`, 0,
+		},
+		{
+			[]string{"-format", "csv"}, testProgram,
+			`kind,syn,text,offset,row,col,end_offset,end_row,end_col,value,file
+id,10,x,0,1,1,1,1,2,,
+:=,18,:=,1,1,2,3,1,4,,
+string,29,"'a,""b'''",3,1,4,11,1,12,"a,""b'",
+#,0,#,12,2,1,12,2,1,,
+`, 0,
+		},
+		{nil, "x ?", "<'x', 10>\n<'?', 31>\n<'#', 0>\n", 1},
+		{[]string{"-format", "xml"}, testProgram, "", 2},
+	}
+	for _, test := range tests {
+		var out, errs strings.Builder
+		code := run(test.args, strings.NewReader(test.in), &out, &errs)
+		if code != test.code || out.String() != test.out {
+			t.Errorf("%v: got exit %d and\n%s\nexpected exit %d and\n%s", test.args, code, out.String(), test.code, test.out)
+		}
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.lab"), filepath.Join(dir, "b.lab")
+	if err := ioutil.WriteFile(a, []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(b, []byte("\n ?"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out, errs strings.Builder
+	if code := run([]string{"-format", "csv", a, b}, strings.NewReader(""), &out, &errs); code != 1 {
+		t.Fatalf("got exit %d, expected 1 for the error in b.lab", code)
+	}
+	want := `kind,syn,text,offset,row,col,end_offset,end_row,end_col,value,file
+id,10,x,0,1,1,1,1,2,,` + a + `
+#,0,#,2,2,1,2,2,1,,` + a + `
+illegal,31,?,2,2,2,3,2,3,,` + b + `
+#,0,#,3,2,3,3,2,3,,` + b + `
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nexpected\n%s", out.String(), want)
+	}
+	if want := b + ":2:2 illegal chars \"?\"\n"; errs.String() != want {
+		t.Errorf("got errors %q, expected %q", errs.String(), want)
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "tokens.txt")
+	var out, errs strings.Builder
+	if code := run([]string{"-o", name}, strings.NewReader("x"), &out, &errs); code != 0 {
+		t.Fatalf("got exit %d: %s", code, errs.String())
+	}
+	if out.Len() != 0 {
+		t.Errorf("got stdout %q, expected nothing", out.String())
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<'x', 10>\n<'#', 0>\n"; string(data) != want {
+		t.Errorf("got file\n%s\nexpected\n%s", data, want)
+	}
+
+	if code := run([]string{"-o", filepath.Join(name, "no", "dir")}, strings.NewReader("x"), &out, &errs); code != 2 {
+		t.Errorf("got exit %d for a bad output path, expected 2", code)
+	}
+}
+
+func TestRunDiagram(t *testing.T) {
+	var out, errs strings.Builder
+	if code := run([]string{"-diagram", "dot"}, strings.NewReader(""), &out, &errs); code != 0 {
+		t.Fatalf("got exit %d: %s", code, errs.String())
+	}
+	for _, tok := range []string{"begin", "while", "id", "realnum", "string", "char", "comment", "#"} {
+		if !strings.Contains(out.String(), `\n`+tok+`"];`) {
+			t.Errorf("no accepting state of %s in\n%s", tok, out.String())
+		}
+	}
+}